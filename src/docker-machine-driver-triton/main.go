@@ -1,17 +1,55 @@
 package main
 
 import (
+	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine/drivers/plugin"
 	"github.com/docker/machine/libmachine/drivers/plugin/localbinary"
 
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"triton"
 )
 
 func main() {
+	triton.Version = Version
+	triton.GitCommit = GitCommit
+
+	// docker-machine regenerate-certs can't renew the client certificate
+	// of sdc-docker machines, the driver does it when run by hand.
+	if len(os.Args) > 1 && os.Args[1] == "regenerate-certs" {
+		err := regenerateCerts(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if os.Getenv(localbinary.PluginEnvKey) != localbinary.PluginEnvVal {
 		fmt.Printf("VERSION: %s, COMMIT: %s\n", Version, GitCommit)
 	}
 	plugin.RegisterDriver(new(triton.Driver))
 }
+
+// regenerateCerts renews the client certificate of a machine of the
+// docker-machine store given with -s or --storage-path, the one of
+// MACHINE_STORAGE_PATH (~/.docker/machine by default) otherwise.
+func regenerateCerts(args []string) error {
+	flags := flag.NewFlagSet("regenerate-certs", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: docker-machine-driver-triton regenerate-certs [-s <storage path>] <machine>")
+		flags.PrintDefaults()
+	}
+	var storagePath string
+	flags.StringVar(&storagePath, "s", mcndirs.GetBaseDir(), "docker-machine storage path (MACHINE_STORAGE_PATH)")
+	flags.StringVar(&storagePath, "storage-path", mcndirs.GetBaseDir(), "docker-machine storage path (MACHINE_STORAGE_PATH)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	return triton.RegenerateMachineCertificates(filepath.Join(storagePath, "machines", flags.Arg(0)))
+}
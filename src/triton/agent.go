@@ -0,0 +1,137 @@
+package triton
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var (
+	md5FingerprintRegexp    = regexp.MustCompile(`^(MD5:)?([0-9a-fA-F]{2}:){15}[0-9a-fA-F]{2}$`)
+	sha256FingerprintRegexp = regexp.MustCompile(`^SHA256:[A-Za-z0-9+/]{43}=?$`)
+)
+
+// IsKeyFingerprint reports whether s is an SSH key fingerprint, either in
+// the colon separated MD5 form or in the "SHA256:<base64>" form.
+func IsKeyFingerprint(s string) bool {
+	return md5FingerprintRegexp.MatchString(s) || sha256FingerprintRegexp.MatchString(s)
+}
+
+// keyMatchesFingerprint reports whether an SSH public key has the given
+// MD5 or SHA256 fingerprint.
+func keyMatchesFingerprint(key ssh.PublicKey, fingerprint string) bool {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		return strings.TrimRight(ssh.FingerprintSHA256(key), "=") == strings.TrimRight(fingerprint, "=")
+	}
+	fingerprint = strings.ToLower(strings.TrimPrefix(fingerprint, "MD5:"))
+	return ssh.FingerprintLegacyMD5(key) == fingerprint
+}
+
+// agentSigner is a Signer backed by a key held in ssh-agent, so the
+// private key never has to be read from disk.
+type agentSigner struct {
+	agent agent.ExtendedAgent
+	key   ssh.PublicKey
+}
+
+// NewAgentSigner connects to the ssh-agent listening on SSH_AUTH_SOCK and
+// returns a Signer for the key with the given MD5 or SHA256 fingerprint.
+func NewAgentSigner(fingerprint string) (Signer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("ssh-agent: SSH_AUTH_SOCK is not set, unable to use key " + fingerprint)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: unable to connect to %s: %s", socket, err)
+	}
+
+	return newAgentSigner(agent.NewClient(conn), fingerprint)
+}
+
+// newAgentSigner returns a Signer for the agent key with the given
+// fingerprint.
+func newAgentSigner(ag agent.ExtendedAgent, fingerprint string) (*agentSigner, error) {
+	keys, err := ag.List()
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: unable to list keys: %s", err)
+	}
+
+	for _, k := range keys {
+		if keyMatchesFingerprint(k, fingerprint) {
+			return &agentSigner{agent: ag, key: k}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("ssh-agent: no key with fingerprint %s (the agent holds %d keys)", fingerprint, len(keys))
+}
+
+// PublicKey returns the SSH public key of the agent key.
+func (a *agentSigner) PublicKey() ssh.PublicKey {
+	return a.key
+}
+
+// Sign asks the agent to sign data and returns the signature in the same
+// form as the in-process signers (PKCS#1 v1.5 for RSA, DER for ECDSA and
+// raw for Ed25519).
+func (a *agentSigner) Sign(data []byte) ([]byte, error) {
+	var flags agent.SignatureFlags
+	if a.key.Type() == ssh.KeyAlgoRSA {
+		flags = agent.SignatureFlagRsaSha256
+	}
+
+	sig, err := a.agent.SignWithFlags(a.key, data, flags)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: signing failed: %s", err)
+	}
+
+	switch sig.Format {
+	case ssh.KeyAlgoRSASHA256, ssh.KeyAlgoED25519:
+		return sig.Blob, nil
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		var ecSig struct {
+			R *big.Int
+			S *big.Int
+		}
+		err = ssh.Unmarshal(sig.Blob, &ecSig)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(ecdsaSignature{ecSig.R, ecSig.S})
+	default:
+		return nil, fmt.Errorf("ssh-agent: unsupported signature format %q", sig.Format)
+	}
+}
+
+func (a *agentSigner) SignToString(data []byte) (string, error) {
+	sig, err := a.Sign(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (a *agentSigner) Algorithm() string {
+	switch a.key.Type() {
+	case ssh.KeyAlgoECDSA256:
+		return "ecdsa-sha256"
+	case ssh.KeyAlgoECDSA384:
+		return "ecdsa-sha384"
+	case ssh.KeyAlgoECDSA521:
+		return "ecdsa-sha512"
+	case ssh.KeyAlgoED25519:
+		return "ed25519-sha512"
+	default:
+		return "rsa-sha256"
+	}
+}
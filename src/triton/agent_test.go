@@ -0,0 +1,147 @@
+package triton
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newFakeAgent serves an in-process ssh-agent holding the given private
+// key on a unix socket that SSH_AUTH_SOCK points to, and returns a client
+// connected to it and a function stopping it.
+func newFakeAgent(t *testing.T, key interface{}) (agent.ExtendedAgent, func()) {
+	keyring := agent.NewKeyring()
+	err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: "test@triton"})
+	assert.Nil(t, err, "Can't add key to agent")
+
+	dir, err := ioutil.TempDir("", "triton-agent")
+	assert.Nil(t, err, "can't create temp dir")
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err, "Can't listen on the agent socket")
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	ssh_auth_sock := os.Getenv("SSH_AUTH_SOCK")
+	os.Setenv("SSH_AUTH_SOCK", socket)
+
+	client, err := net.Dial("unix", socket)
+	assert.Nil(t, err, "Can't connect to the agent")
+
+	return agent.NewClient(client), func() {
+		client.Close()
+		listener.Close()
+		os.Setenv("SSH_AUTH_SOCK", ssh_auth_sock)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIsKeyFingerprint(t *testing.T) {
+	assert.True(t, IsKeyFingerprint("22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42"))
+	assert.True(t, IsKeyFingerprint("MD5:22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42"))
+	assert.True(t, IsKeyFingerprint("SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"))
+	assert.False(t, IsKeyFingerprint("../../fixup/id_rsa"))
+	assert.False(t, IsKeyFingerprint("id_rsa"))
+}
+
+func TestAgentSignerRsa(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+	out_data := "B0qFg0BQzLALM5uVxo01bZ4NcZEc4IfWSrAtuC/5cQiYDSl/9HbhXcwpC3ylToW5d9urs8oSTSf7kAI/oqYTzy+7cFzdOs1qiwNdiz5noyQkuW9kxe3Yi1H2qolzSZj5ila1eqnDzE+sUORNl/EuO8kxMwGSs6TCMYQvV6tuo4ecnhd4M5rrYgjpZSvacQ+Ng+zgv5FYVtLs8EbyL9A/80Cc9dmDsCd9EKTOmCIgNFSQFx3K8igv8BGWpzafvlakmA6TcoJ+QdGtlslxw1wwdhP61BEUr9h4MtFj+EfO8C7LF00/9tbAUN71a7XEY6pu8cKuX1TBAppMRZjuQ9b0Fg=="
+
+	key, err := LoadRawPrivateKey("../../fixup/id_rsa", "")
+	assert.Nil(t, err, "Can't load private key")
+
+	ag, done := newFakeAgent(t, key)
+	defer done()
+
+	signer, err := newAgentSigner(ag, "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42")
+	assert.Nil(t, err, "Can't find key in agent")
+	assert.Equal(t, "rsa-sha256", signer.Algorithm())
+
+	data, err := signer.SignToString([]byte(in_data))
+	assert.Nil(t, err, "Error on signing the message")
+	assert.Equal(t, out_data, data, "Result don't match!")
+
+	digest := sha256.Sum256([]byte(in_data))
+	sig, err := signer.Sign([]byte(in_data))
+	assert.Nil(t, err, "Error on signing the message")
+	assert.Nil(t, rsa.VerifyPKCS1v15(&key.(*rsa.PrivateKey).PublicKey, crypto.SHA256, digest[:], sig))
+}
+
+func TestAgentSignerEcdsaBySha256Fingerprint(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+
+	key, err := LoadRawPrivateKey("../../fixup/id_ecdsa", "")
+	assert.Nil(t, err, "Can't load private key")
+
+	ag, done := newFakeAgent(t, key)
+	defer done()
+
+	pub, err := ssh.NewPublicKey(&key.(*ecdsa.PrivateKey).PublicKey)
+	assert.Nil(t, err, "invalid public key")
+
+	signer, err := newAgentSigner(ag, ssh.FingerprintSHA256(pub))
+	assert.Nil(t, err, "Can't find key in agent")
+	assert.Equal(t, "ecdsa-sha256", signer.Algorithm())
+
+	sig, err := signer.Sign([]byte(in_data))
+	assert.Nil(t, err, "Error on signing the message")
+
+	var ecSig ecdsaSignature
+	_, err = asn1.Unmarshal(sig, &ecSig)
+	assert.Nil(t, err, "Signature is not DER encoded")
+
+	digest := sha256.Sum256([]byte(in_data))
+	assert.True(t, ecdsa.Verify(&key.(*ecdsa.PrivateKey).PublicKey, digest[:], ecSig.R, ecSig.S), "Signature doesn't verify")
+}
+
+func TestAgentSignerEd25519(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+
+	key, err := LoadRawPrivateKey("../../fixup/id_ed25519", "")
+	assert.Nil(t, err, "Can't load private key")
+
+	ag, done := newFakeAgent(t, key)
+	defer done()
+
+	pub, err := ssh.NewPublicKey(key.(ed25519.PrivateKey).Public())
+	assert.Nil(t, err, "invalid public key")
+
+	signer, err := newAgentSigner(ag, "MD5:"+ssh.FingerprintLegacyMD5(pub))
+	assert.Nil(t, err, "Can't find key in agent")
+	assert.Equal(t, "ed25519-sha512", signer.Algorithm())
+
+	sig, err := signer.Sign([]byte(in_data))
+	assert.Nil(t, err, "Error on signing the message")
+	assert.True(t, ed25519.Verify(key.(ed25519.PrivateKey).Public().(ed25519.PublicKey), []byte(in_data), sig), "Signature doesn't verify")
+}
+
+func TestAgentSignerUnknownKey(t *testing.T) {
+	key, err := LoadRawPrivateKey("../../fixup/id_rsa", "")
+	assert.Nil(t, err, "Can't load private key")
+
+	ag, done := newFakeAgent(t, key)
+	defer done()
+
+	_, err = newAgentSigner(ag, "25:ac:dd:f0:b2:f8:f3:9b:df:69:d7:32:5f:87:6b:e2")
+	assert.NotNil(t, err, "Found a key that isn't in the agent")
+}
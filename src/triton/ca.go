@@ -0,0 +1,201 @@
+package triton
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// maxCaSize bounds the ca.pem downloaded from sdc-docker.
+const maxCaSize = 1 << 20
+
+// CertFingerprint returns the SHA-256 fingerprint of a certificate the way
+// 'openssl x509 -fingerprint -sha256' prints it, e.g. "AB:CD:...".
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return colonHex(sum[:])
+}
+
+// colonHex returns the upper case hex digits of b, separated by colons.
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = fmt.Sprintf("%02X", b[i])
+	}
+	return strings.Join(parts, ":")
+}
+
+// normalizeCaFingerprint returns a SHA-256 fingerprint given with or
+// without colons, in any case and optionally prefixed by "sha256:", in the
+// form returned by CertFingerprint.
+func normalizeCaFingerprint(fingerprint string) (string, error) {
+	hexSum := strings.TrimSpace(fingerprint)
+	if i := strings.Index(hexSum, ":"); i == len("sha256") && strings.EqualFold(hexSum[:i], "sha256") {
+		hexSum = hexSum[i+1:]
+	}
+	sum, err := hex.DecodeString(strings.Replace(hexSum, ":", "", -1))
+	if err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf("%q is not a SHA-256 fingerprint, expected 64 hex digits", fingerprint)
+	}
+	return colonHex(sum), nil
+}
+
+// parseCertificates returns the certificates of a PEM bundle.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+// caFingerprints returns the fingerprints of the certificates of a PEM
+// bundle, comma separated.
+func caFingerprints(data []byte) (string, error) {
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return "", err
+	}
+	fingerprints := make([]string, len(certs))
+	for i, cert := range certs {
+		fingerprints[i] = CertFingerprint(cert)
+	}
+	return strings.Join(fingerprints, ","), nil
+}
+
+// loadCertPool returns a pool of the certificates of a PEM bundle file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the CA bundle %s: %s", file, err)
+	}
+
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// apiTransport returns the transport for CloudAPI and for downloading
+// the sdc-docker CA: the --triton-ca-cert bundle, or else the system CAs,
+// is trusted unless --triton-skip-tls-verify is given.
+func (d *Driver) apiTransport() (*http.Transport, error) {
+	return d.sharedTransport(d.CaCert)
+}
+
+// dockerTransport returns the transport for the sdc-docker endpoint, which
+// trusts the CA the docker client does: the ca.pem downloaded when the
+// machine was created.
+func (d *Driver) dockerTransport() (*http.Transport, error) {
+	caFile := d.ResolveStorePath("ca.pem")
+	if _, err := os.Stat(caFile); os.IsNotExist(err) {
+		return d.apiTransport()
+	}
+	return d.sharedTransport(caFile)
+}
+
+// fetchCa returns the ca.pem served by the sdc-docker endpoint.
+func (d *Driver) fetchCa() ([]byte, error) {
+	caUrl := fmt.Sprintf("%s/ca.pem", d.GetHttpsURL())
+	log.Debugf("Downloading ca.pem file from %s", caUrl)
+
+	transport, err := d.apiTransport()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.httpClient(transport).Get(caUrl)
+	if err != nil {
+		log.Debugf("Unable to open http request to url: %s", caUrl)
+		if isUnknownAuthority(err) {
+			return nil, fmt.Errorf("Unable to verify %s, pass the CA of your cloud using --triton-ca-cert: %s", caUrl, err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to download %s: %s", caUrl, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxCaSize))
+}
+
+// checkCaFingerprint verifies the fingerprints of a downloaded ca.pem
+// match --triton-ca-fingerprint.
+func (d *Driver) checkCaFingerprint(fingerprints string) error {
+	if d.CaFingerprint == "" {
+		log.Infof("Trusting the sdc-docker CA %s of %s, pin it using --triton-ca-fingerprint", fingerprints, d.DockerApiURL)
+		return nil
+	}
+
+	for _, fingerprint := range strings.Split(fingerprints, ",") {
+		if fingerprint == d.CaFingerprint {
+			return nil
+		}
+	}
+	return fmt.Errorf("The sdc-docker CA of %s has the SHA-256 fingerprint %s, not the --triton-ca-fingerprint %s",
+		d.DockerApiURL, fingerprints, d.CaFingerprint)
+}
+
+// explainCertificateError checks whether the sdc-docker endpoint failing
+// verification is due to its CA having changed since ca.pem was
+// downloaded, and reports it as such.
+func (d *Driver) explainCertificateError(err error) error {
+	data, readErr := ioutil.ReadFile(d.ResolveStorePath("ca.pem"))
+	if readErr != nil {
+		return err
+	}
+	stored, readErr := caFingerprints(data)
+	if readErr != nil {
+		return err
+	}
+
+	data, fetchErr := d.fetchCa()
+	if fetchErr != nil {
+		log.Debugf("Unable to download the current CA of %s: %s", d.DockerApiURL, fetchErr)
+		return err
+	}
+	current, fetchErr := caFingerprints(data)
+	if fetchErr != nil || current == stored {
+		return err
+	}
+
+	return fmt.Errorf("The sdc-docker CA of %s changed from %s to %s, verify the new CA with your cloud operator and recreate the machine (pinning it using --triton-ca-fingerprint): %s",
+		d.DockerApiURL, stored, current, err)
+}
+
+// isUnknownAuthority reports whether a request failed because the server
+// certificate isn't signed by a trusted CA.
+func isUnknownAuthority(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	return errors.As(err, &unknownAuthority)
+}
@@ -0,0 +1,216 @@
+package triton
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func certificatePem(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// newTestCa returns a self-signed CA certificate unrelated to the one of
+// the test servers.
+func newTestCa(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "Can't generate key")
+
+	serial, err := randomSerialNumber()
+	assert.Nil(t, err, "Can't generate serial number")
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.Nil(t, err, "Can't create certificate")
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err, "Can't parse certificate")
+	return cert
+}
+
+// newCaServer serves an sdc-docker endpoint whose ca.pem is the
+// certificate of the server itself, and a driver with a store in a temp
+// dir and the server certificate as --triton-ca-cert.
+func newCaServer(t *testing.T) (*httptest.Server, *Driver, func()) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ca.pem":
+			w.Write(certificatePem(server.Certificate()))
+		case "/_ping":
+			w.Write([]byte("OK"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	dir, err := ioutil.TempDir("", "triton-ca")
+	assert.Nil(t, err, "can't create temp dir")
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "machines", "test-machine"), 0700))
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	assert.Nil(t, ioutil.WriteFile(bundle, certificatePem(server.Certificate()), 0644))
+
+	d := &Driver{
+		BaseDriver:   &drivers.BaseDriver{MachineName: "test-machine", StorePath: dir},
+		DockerApiURL: strings.Replace(server.URL, "https://", "tcp://", 1),
+		CaCert:       bundle,
+	}
+	return server, d, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNormalizeCaFingerprint(t *testing.T) {
+	expected := "AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89"
+	for _, fingerprint := range []string{
+		expected,
+		strings.ToLower(expected),
+		strings.Replace(expected, ":", "", -1),
+		"sha256:" + expected,
+		"SHA256:" + strings.Replace(expected, ":", "", -1),
+	} {
+		normalized, err := normalizeCaFingerprint(fingerprint)
+		assert.Nil(t, err, fingerprint)
+		assert.Equal(t, expected, normalized)
+	}
+
+	for _, fingerprint := range []string{"", "AB:CD", "md5:" + expected, expected + ":00"} {
+		_, err := normalizeCaFingerprint(fingerprint)
+		assert.NotNil(t, err, "Accepted %q", fingerprint)
+	}
+}
+
+func TestDownloadCa(t *testing.T) {
+	server, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	d.CaFingerprint = CertFingerprint(server.Certificate())
+	assert.Nil(t, d.DownloadCa())
+
+	data, err := ioutil.ReadFile(d.ResolveStorePath("ca.pem"))
+	assert.Nil(t, err, "ca.pem wasn't written")
+	assert.Equal(t, certificatePem(server.Certificate()), data)
+
+	s, err := d.GetState()
+	assert.Nil(t, err)
+	assert.Equal(t, state.Running, s)
+}
+
+func TestDownloadCaPinMismatch(t *testing.T) {
+	server, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	d.CaFingerprint = CertFingerprint(newTestCa(t))
+	err := d.DownloadCa()
+	assert.NotNil(t, err, "Accepted a CA that isn't pinned")
+	assert.Contains(t, err.Error(), CertFingerprint(server.Certificate()))
+
+	_, err = os.Stat(d.ResolveStorePath("ca.pem"))
+	assert.True(t, os.IsNotExist(err), "wrote a CA that isn't pinned")
+}
+
+func TestDownloadCaUnknownAuthority(t *testing.T) {
+	_, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	d.CaCert = ""
+	err := d.DownloadCa()
+	assert.NotNil(t, err, "Trusted an unknown CA")
+	assert.Contains(t, err.Error(), "--triton-ca-cert")
+
+	d.SkipTlsVerify = true
+	assert.Nil(t, d.DownloadCa())
+}
+
+func TestGetStateCaRotation(t *testing.T) {
+	server, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	previous := newTestCa(t)
+	assert.Nil(t, ioutil.WriteFile(d.ResolveStorePath("ca.pem"), certificatePem(previous), 0644))
+
+	s, err := d.GetState()
+	assert.Equal(t, state.Error, s)
+	assert.NotNil(t, err, "Trusted a CA other than ca.pem")
+	assert.Contains(t, err.Error(), "changed from "+CertFingerprint(previous)+" to "+CertFingerprint(server.Certificate()))
+}
+
+func TestVerifyDockerEndpoint(t *testing.T) {
+	server, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	assert.Nil(t, d.DownloadCa())
+	assert.Nil(t, d.verifyDockerEndpoint())
+	assert.Equal(t, CertFingerprint(server.Certificate()), d.DockerCertFingerprint)
+
+	s, err := d.GetState()
+	assert.Nil(t, err)
+	assert.Equal(t, state.Running, s)
+
+	// The endpoint served another certificate since.
+	d.DockerCertFingerprint = CertFingerprint(newTestCa(t))
+	s, err = d.GetState()
+	assert.Nil(t, err, "A verified certificate that changed is only warned about")
+	assert.Equal(t, state.Running, s)
+
+	d.SkipTlsVerify = true
+	s, err = d.GetState()
+	assert.Equal(t, state.Error, s)
+	assert.NotNil(t, err, "Accepted an unverified certificate that changed")
+	assert.Contains(t, err.Error(), "changed from")
+}
+
+func TestVerifyDockerEndpointOtherCa(t *testing.T) {
+	_, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	assert.Nil(t, ioutil.WriteFile(d.ResolveStorePath("ca.pem"), certificatePem(newTestCa(t)), 0644))
+	err := d.verifyDockerEndpoint()
+	assert.NotNil(t, err, "Accepted a certificate that isn't signed by ca.pem")
+	assert.Contains(t, err.Error(), "isn't signed by the sdc-docker CA")
+	assert.Equal(t, "", d.DockerCertFingerprint)
+}
+
+func TestVerifyDockerEndpointHostname(t *testing.T) {
+	_, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	assert.Nil(t, d.DownloadCa())
+	// The test certificate is only valid for 127.0.0.1 and example.com.
+	d.DockerApiURL = strings.Replace(d.DockerApiURL, "127.0.0.1", "localhost", 1)
+	err := d.verifyDockerEndpoint()
+	assert.NotNil(t, err, "Accepted a certificate for another host")
+	assert.Contains(t, err.Error(), "not localhost")
+}
+
+func TestGetClientMissingCaCert(t *testing.T) {
+	d := &Driver{Account: "test", CloudApiURL: "https://us-test-1.api.example.com", CaCert: "../../fixup/missing.pem"}
+	_, err := d.getClient()
+	assert.NotNil(t, err, "Used CloudAPI without the CA bundle")
+	assert.Contains(t, err.Error(), "--triton-ca-cert")
+	assert.Contains(t, err.Error(), "missing.pem")
+}
@@ -0,0 +1,223 @@
+package triton
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// ClientCertValidity is how long the generated sdc-docker client
+// certificate is valid for.
+const ClientCertValidity = 365 * 24 * time.Hour
+
+// ServerCertValidity is how long the generated server certificate is
+// valid for. Nothing verifies it, it only has to exist.
+const ServerCertValidity = ClientCertValidity
+
+// marshalPrivateKey returns the PEM block for a private key.
+func marshalPrivateKey(key interface{}) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	case ed25519.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+	default:
+		return nil, fmt.Errorf("ssh: unsupported key type %T", key)
+	}
+}
+
+// writePemFile writes a single PEM block to path, readable only by the
+// current user.
+func writePemFile(path string, block *pem.Block) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = pem.Encode(out, block)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// randomSerialNumber returns a random 128 bit certificate serial number.
+func randomSerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, limit)
+}
+
+// GenerateClientCertificate writes the private key (keyFile), a certificate
+// signing request (csrFile) and a self-signed client certificate (certFile)
+// for the given SSH private key, the same way
+//
+//	openssl req -new -key key.pem -subj /CN=<commonName>
+//	openssl x509 -req -days 365 -signkey key.pem
+//
+// would. sdc-docker authenticates the account by the key that signed it.
+func GenerateClientCertificate(key interface{}, commonName string, keyFile string, csrFile string, certFile string) (*x509.Certificate, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("ssh: unsupported key type %T", key)
+	}
+
+	keyBlock, err := marshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = writePemFile(keyFile, keyBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	csrTemplate := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, signer)
+	if err != nil {
+		return nil, err
+	}
+	err = writePemFile(csrFile, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(ClientCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+	err = writePemFile(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(certBytes)
+}
+
+// GenerateServerCertificate writes a new ECDSA P-256 private key (keyFile)
+// and a self-signed server certificate for host (certFile). The key is
+// generated for the certificate alone and shares nothing with the SSH key.
+func GenerateServerCertificate(host string, keyFile string, certFile string) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	subjectKeyId, err := subjectKeyId(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: host,
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(ServerCertValidity),
+		SubjectKeyId:          subjectKeyId,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBlock, err := marshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = writePemFile(keyFile, keyBlock)
+	if err != nil {
+		return nil, err
+	}
+	err = writePemFile(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(certBytes)
+}
+
+// subjectKeyId returns the SHA-1 hash of the subject public key, as in
+// RFC 5280 section 4.2.1.2.
+func subjectKeyId(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	_, err = asn1.Unmarshal(der, &spki)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return sum[:], nil
+}
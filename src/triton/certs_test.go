@@ -0,0 +1,133 @@
+package triton
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readPemFile(t *testing.T, path string) *pem.Block {
+	info, err := os.Stat(path)
+	assert.Nil(t, err, "file was not written")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "file is readable by others")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "can't read file")
+
+	block, _ := pem.Decode(data)
+	assert.NotNil(t, block, "file is not PEM encoded")
+	return block
+}
+
+func parsePemKey(t *testing.T, block *pem.Block) interface{} {
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	assert.Nil(t, err, "invalid key.pem")
+	return key
+}
+
+func checkClientCertificate(t *testing.T, ssh_private_key_path string, password string, key_type string) {
+	key, err := LoadRawPrivateKey(ssh_private_key_path, password)
+	assert.Nil(t, err, "Can't load private key")
+
+	checkClientCertificateForKey(t, key, key_type)
+}
+
+func checkClientCertificateForKey(t *testing.T, key interface{}, key_type string) {
+	dir, err := ioutil.TempDir("", "triton-certs")
+	assert.Nil(t, err, "can't create temp dir")
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key.pem")
+	csrFile := filepath.Join(dir, "cert.csr")
+	certFile := filepath.Join(dir, "cert.pem")
+
+	cert, err := GenerateClientCertificate(key, "testaccount", keyFile, csrFile, certFile)
+	assert.Nil(t, err, "Error generating the client certificate")
+
+	keyBlock := readPemFile(t, keyFile)
+	assert.Equal(t, key_type, keyBlock.Type)
+	pemKey := parsePemKey(t, keyBlock)
+	assert.True(t, reflect.DeepEqual(key, pemKey), "key.pem doesn't match the SSH key")
+
+	csrBlock := readPemFile(t, csrFile)
+	assert.Equal(t, "CERTIFICATE REQUEST", csrBlock.Type)
+	csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+	assert.Nil(t, err, "invalid cert.csr")
+	assert.Equal(t, "testaccount", csr.Subject.CommonName)
+
+	certBlock := readPemFile(t, certFile)
+	assert.Equal(t, "CERTIFICATE", certBlock.Type)
+	parsed, err := x509.ParseCertificate(certBlock.Bytes)
+	assert.Nil(t, err, "invalid cert.pem")
+	assert.Equal(t, cert.Raw, parsed.Raw, "returned certificate doesn't match cert.pem")
+	assert.Equal(t, "testaccount", parsed.Subject.CommonName)
+	assert.Nil(t, parsed.CheckSignature(parsed.SignatureAlgorithm, parsed.RawTBSCertificate, parsed.Signature), "certificate is not self-signed")
+	assert.Equal(t, ClientCertValidity, parsed.NotAfter.Sub(parsed.NotBefore))
+}
+
+func TestGenerateClientCertificate(t *testing.T) {
+	checkClientCertificate(t, "../../fixup/id_rsa", "", "RSA PRIVATE KEY")
+}
+
+func TestGenerateClientCertificateWithPasswordProtectedCert(t *testing.T) {
+	checkClientCertificate(t, "../../fixup/pass_id_rsa", "testing", "RSA PRIVATE KEY")
+}
+
+func TestGenerateClientCertificateEcdsa(t *testing.T) {
+	checkClientCertificate(t, "../../fixup/id_ecdsa", "", "EC PRIVATE KEY")
+}
+
+func TestGenerateClientCertificateEd25519(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err, "Can't generate ed25519 key")
+
+	checkClientCertificateForKey(t, key, "PRIVATE KEY")
+}
+
+func TestGenerateServerCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "triton-certs")
+	assert.Nil(t, err, "can't create temp dir")
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "server-key.pem")
+	certFile := filepath.Join(dir, "server.pem")
+
+	cert, err := GenerateServerCertificate("us-east-1.docker.joyent.com", keyFile, certFile)
+	assert.Nil(t, err, "Error generating the server certificate")
+	assert.Equal(t, []string{"us-east-1.docker.joyent.com"}, cert.DNSNames)
+	assert.Equal(t, ServerCertValidity, cert.NotAfter.Sub(cert.NotBefore))
+	assert.Len(t, cert.SubjectKeyId, 20)
+	assert.Nil(t, cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature), "certificate is not self-signed")
+
+	keyBlock := readPemFile(t, keyFile)
+	assert.Equal(t, "EC PRIVATE KEY", keyBlock.Type)
+	key := parsePemKey(t, keyBlock)
+	sshKey, err := LoadRawPrivateKey("../../fixup/id_rsa", "")
+	assert.Nil(t, err, "Can't load private key")
+	assert.False(t, reflect.DeepEqual(sshKey, key), "server-key.pem is the SSH key")
+	assert.True(t, reflect.DeepEqual(key.(*ecdsa.PrivateKey).Public(), cert.PublicKey), "server-key.pem doesn't match server.pem")
+
+	other, err := GenerateServerCertificate("165.225.128.1", filepath.Join(dir, "other-key.pem"), filepath.Join(dir, "other.pem"))
+	assert.Nil(t, err, "Error generating the server certificate")
+	assert.Equal(t, "165.225.128.1", other.IPAddresses[0].String())
+	assert.False(t, cert.SerialNumber.Cmp(other.SerialNumber) == 0, "serial numbers are reused")
+	assert.False(t, reflect.DeepEqual(cert.SubjectKeyId, other.SubjectKeyId), "keys are reused")
+}
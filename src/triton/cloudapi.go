@@ -0,0 +1,243 @@
+package triton
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"triton/cloudapi"
+)
+
+// getPrivateKey loads the private key once and caches it on the driver, so
+// password protected keys only prompt a single time per command.
+func (d *Driver) getPrivateKey() (interface{}, error) {
+	if d.privateKey != nil {
+		return d.privateKey, nil
+	}
+	if d.UsesAgent() {
+		return nil, fmt.Errorf("The key %s is only available through ssh-agent, pass the path of the private key file using --triton-key instead", d.PrivateKey)
+	}
+
+	key, err := LoadRawPrivateKey(d.PrivateKey, "")
+	if err == ErrPassphraseRequired {
+		var passphrase string
+		passphrase, err = d.getKeyPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		key, err = LoadRawPrivateKey(d.PrivateKey, passphrase)
+	}
+	if err != nil {
+		log.Debugf("error loading the private key! %+v\n", err)
+		return nil, err
+	}
+	d.privateKey = key
+
+	return key, nil
+}
+
+// getSigner returns the request signer for the driver's private key.
+func (d *Driver) getSigner() (Signer, error) {
+	if d.signer != nil {
+		return d.signer, nil
+	}
+
+	if d.UsesAgent() {
+		signer, err := NewAgentSigner(d.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		d.signer = signer
+		return signer, nil
+	}
+
+	key, err := d.getPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	d.signer = signer
+
+	return signer, nil
+}
+
+// UsesAgent reports whether the key was given as a fingerprint of a key
+// held by ssh-agent rather than a private key file.
+func (d *Driver) UsesAgent() bool {
+	return IsKeyFingerprint(d.PrivateKey)
+}
+
+// getPublicKey returns the SSH public key of the account key. For key
+// files it is derived from the private key, so a missing or stale .pub file
+// doesn't matter.
+func (d *Driver) getPublicKey() (ssh.PublicKey, error) {
+	if d.publicKey != nil {
+		return d.publicKey, nil
+	}
+
+	signer, err := d.getSigner()
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := signer.(*agentSigner); ok {
+		d.publicKey = a.PublicKey()
+		return d.publicKey, nil
+	}
+
+	key, err := d.getPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := publicKeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	checkPublicKeyFile(d.PrivateKey+".pub", publicKey)
+	d.publicKey = publicKey
+
+	return publicKey, nil
+}
+
+// keyIdFormat returns the configured key id format, MD5 by default.
+func (d *Driver) keyIdFormat() string {
+	if d.KeyIdFormat == "" {
+		return KeyIdFormatMD5
+	}
+	return d.KeyIdFormat
+}
+
+// getKeyId returns the fingerprint CloudAPI knows the key by, in the
+// given key id format.
+func (d *Driver) getKeyId(format string) (string, error) {
+	key, err := d.getPublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	return KeyIdFingerprint(key, format)
+}
+
+// keyIdPath returns the http-signature keyId of the key with the given
+// fingerprint, which for sub-users names the user as well.
+func (d *Driver) keyIdPath(sshKeyId string) string {
+	if d.User != "" {
+		return fmt.Sprintf("/%s/users/%s/keys/%s", d.Account, d.User, sshKeyId)
+	}
+	return fmt.Sprintf("/%s/keys/%s", d.Account, sshKeyId)
+}
+
+// getRequestSigner returns the http-signature signer for CloudAPI requests
+// identifying the key by its fingerprint in the given format.
+func (d *Driver) getRequestSigner(format string) (*RequestSigner, error) {
+	signer, err := d.getSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	sshKeyId, err := d.getKeyId(format)
+	if err != nil {
+		log.Debugf("Error in getting key fingerprint, %+v\n", err)
+		return nil, err
+	}
+
+	return &RequestSigner{
+		KeyId:   d.keyIdPath(sshKeyId),
+		Signer:  signer,
+		Headers: strings.Fields(d.SignedHeaders),
+	}, nil
+}
+
+// signRequest adds the Date and Authorization headers that CloudAPI
+// requires to authenticate the account.
+func (d *Driver) signRequest(req *http.Request) error {
+	requestSigner, err := d.getRequestSigner(d.keyIdFormat())
+	if err != nil {
+		return err
+	}
+	return requestSigner.SignRequest(req)
+}
+
+// keyIdTransport signs CloudAPI requests with the account key. When
+// CloudAPI rejects the key id, the request is retried once with the
+// fingerprint in the other form, which is then used from there on.
+type keyIdTransport struct {
+	d    *Driver
+	base http.RoundTripper
+}
+
+func (t *keyIdTransport) roundTrip(format string, req *http.Request) (*http.Response, error) {
+	requestSigner, err := t.d.getRequestSigner(format)
+	if err != nil {
+		return nil, err
+	}
+	return (&SigningTransport{Signer: requestSigner, Base: t.base}).RoundTrip(req)
+}
+
+func (t *keyIdTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	format := t.d.keyIdFormat()
+	log.Debugf("CloudAPI request: %s %s", req.Method, req.URL)
+
+	retry := req
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return t.roundTrip(format, req)
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+
+	resp, err := t.roundTrip(format, req)
+	if err != nil || !rejectsKeyId(resp) {
+		return resp, err
+	}
+
+	fallback := otherKeyIdFormat(format)
+	log.Debugf("CloudAPI rejected the %s key id, retrying with the %s key id", format, fallback)
+	retryResp, err := t.roundTrip(fallback, retry)
+	if err != nil || rejectsKeyId(retryResp) {
+		if retryResp != nil {
+			retryResp.Body.Close()
+		}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	log.Infof("CloudAPI accepted the %s key id, using it from now on", fallback)
+	t.d.KeyIdFormat = fallback
+	return retryResp, nil
+}
+
+// rejectsKeyId reports whether a CloudAPI response may be due to the key
+// id not being recognized.
+func rejectsKeyId(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+}
+
+// getClient returns the CloudAPI client of the account, signing requests
+// with the account key.
+func (d *Driver) getClient() (*cloudapi.Client, error) {
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	transport, err := d.apiTransport()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load --triton-ca-cert: %s", err)
+	}
+
+	d.client = cloudapi.NewClient(d.CloudApiURL, d.Account, d.httpClient(&keyIdTransport{
+		d:    d,
+		base: transport,
+	}))
+	d.client.Role = d.Role
+	return d.client, nil
+}
@@ -0,0 +1,102 @@
+package cloudapi
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// Account is the CloudAPI account of the client.
+type Account struct {
+	Id               string    `json:"id"`
+	Login            string    `json:"login"`
+	Email            string    `json:"email"`
+	CompanyName      string    `json:"companyName"`
+	FirstName        string    `json:"firstName"`
+	LastName         string    `json:"lastName"`
+	TritonCNSEnabled bool      `json:"triton_cns_enabled"`
+	Created          time.Time `json:"created"`
+	Updated          time.Time `json:"updated"`
+}
+
+// GetAccount returns the account details.
+func (c *Client) GetAccount(ctx context.Context) (*Account, error) {
+	var account Account
+	_, err := c.do(ctx, "GET", "", nil, nil, &account)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Key is an SSH public key of the account.
+type Key struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	Key         string `json:"key"`
+}
+
+// ListKeys returns the SSH keys of the account.
+func (c *Client) ListKeys(ctx context.Context) ([]*Key, error) {
+	var keys []*Key
+	_, err := c.do(ctx, "GET", "keys", nil, nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ListUserKeys returns the SSH keys of a sub-user of the account.
+func (c *Client) ListUserKeys(ctx context.Context, user string) ([]*Key, error) {
+	var keys []*Key
+	_, err := c.do(ctx, "GET", "users/"+url.PathEscape(user)+"/keys", nil, nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetKey returns the account key with the given name or fingerprint.
+func (c *Client) GetKey(ctx context.Context, name string) (*Key, error) {
+	var key Key
+	_, err := c.do(ctx, "GET", "keys/"+url.PathEscape(name), nil, nil, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateKeyInput describes a key to add to the account.
+type CreateKeyInput struct {
+	// Name of the key, the fingerprint when empty.
+	Name string `json:"name,omitempty"`
+	// Key is the public key in OpenSSH (authorized_keys) format.
+	Key string `json:"key"`
+}
+
+// CreateKey adds an SSH public key to the account.
+func (c *Client) CreateKey(ctx context.Context, input *CreateKeyInput) (*Key, error) {
+	var key Key
+	_, err := c.do(ctx, "POST", "keys", nil, input, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateUserKey adds an SSH public key to a sub-user of the account.
+func (c *Client) CreateUserKey(ctx context.Context, user string, input *CreateKeyInput) (*Key, error) {
+	var key Key
+	_, err := c.do(ctx, "POST", "users/"+url.PathEscape(user)+"/keys", nil, input, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// DeleteKey removes the key with the given name or fingerprint from the
+// account.
+func (c *Client) DeleteKey(ctx context.Context, name string) error {
+	_, err := c.do(ctx, "DELETE", "keys/"+url.PathEscape(name), nil, nil, nil)
+	return err
+}
@@ -0,0 +1,188 @@
+// Package cloudapi is a client for the Triton CloudAPI, see
+// https://apidocs.joyent.com/cloudapi/.
+//
+// The client doesn't authenticate requests itself, the http.Client it is
+// given is expected to sign them (e.g. with triton.SigningTransport).
+package cloudapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultPageSize is the number of items requested per page by the list
+// calls CloudAPI paginates. It is the largest limit CloudAPI accepts.
+const DefaultPageSize = 1000
+
+// Client talks to the CloudAPI of one datacenter on behalf of an account.
+type Client struct {
+	// URL of the CloudAPI endpoint, e.g. "https://us-east-1.api.joyent.com".
+	URL     string
+	Account string
+	// HTTPClient sends the requests, it is responsible for signing them.
+	HTTPClient *http.Client
+	// PageSize overrides DefaultPageSize for paginated list calls.
+	PageSize int
+	// Role lists the comma separated RBAC roles a sub-user assumes for
+	// its requests (sent as the as-role query parameter).
+	Role string
+}
+
+// NewClient returns a client for the account's CloudAPI at url, sending
+// requests through httpClient.
+func NewClient(url string, account string, httpClient *http.Client) *Client {
+	return &Client{
+		URL:        strings.TrimRight(url, "/"),
+		Account:    account,
+		HTTPClient: httpClient,
+	}
+}
+
+// Error is a failed CloudAPI request.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	// RequestId is the id CloudAPI logged the request with, useful when
+	// reporting problems to the operator.
+	RequestId string `json:"-"`
+
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("ERROR: CloudAPI %s %s failed: %s", e.Method, e.Path, e.Message)
+	if e.Code != "" {
+		msg += fmt.Sprintf(" (%s)", e.Code)
+	}
+	if e.RequestId != "" {
+		msg += fmt.Sprintf(" [request-id %s]", e.RequestId)
+	}
+	return msg
+}
+
+// StatusCode returns the HTTP status of a CloudAPI error, or 0 when err
+// isn't one (e.g. the request didn't reach CloudAPI).
+func StatusCode(err error) int {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err means the resource doesn't exist (any
+// more).
+func IsNotFound(err error) bool {
+	status := StatusCode(err)
+	return status == http.StatusNotFound || status == http.StatusGone
+}
+
+func (c *Client) pageSize() int {
+	if c.PageSize > 0 {
+		return c.PageSize
+	}
+	return DefaultPageSize
+}
+
+// do sends a request for the account resource apiPath (e.g. "machines", or
+// "" for the account itself). When body is non-nil it is sent as JSON and
+// when result is non-nil the response is decoded into it. The response
+// headers are returned on success.
+func (c *Client) do(ctx context.Context, method string, apiPath string, query url.Values, body interface{}, result interface{}) (http.Header, error) {
+	if c.Role != "" {
+		roleQuery := url.Values{}
+		for k, v := range query {
+			roleQuery[k] = v
+		}
+		roleQuery.Set("as-role", c.Role)
+		query = roleQuery
+	}
+
+	requestUrl := fmt.Sprintf("%s/%s", c.URL, url.PathEscape(c.Account))
+	if apiPath != "" {
+		requestUrl += "/" + apiPath
+	}
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, requestUrl, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("api-version", "*")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{
+			StatusCode: resp.StatusCode,
+			RequestId:  requestId(resp.Header),
+			Method:     method,
+			Path:       apiPath,
+		}
+		if json.Unmarshal(respBody, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+
+	if result != nil && len(respBody) > 0 {
+		err = json.Unmarshal(respBody, result)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode CloudAPI response for %s %s: %s", method, apiPath, err)
+		}
+	}
+
+	return resp.Header, nil
+}
+
+// requestId returns the id CloudAPI assigned to a request.
+func requestId(header http.Header) string {
+	if id := header.Get("x-request-id"); id != "" {
+		return id
+	}
+	return header.Get("request-id")
+}
+
+// setString adds a query parameter when the value isn't empty.
+func setString(query url.Values, key string, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
@@ -0,0 +1,140 @@
+package cloudapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient returns a client for the test account talking to a
+// CloudAPI served by handler.
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	return NewClient(server.URL+"/", "test", server.Client()), server.Close
+}
+
+func TestListServices(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/test/services", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		w.Write([]byte(`{"docker":"tcp://us-east-1.docker.joyent.com:2376","cloudapi":"https://us-east-1.api.joyent.com"}`))
+	})
+	defer done()
+
+	services, err := client.ListServices(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://us-east-1.docker.joyent.com:2376", services["docker"])
+}
+
+func TestGetAccount(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/test", r.URL.Path)
+		w.Write([]byte(`{"id":"cc71f8bb-f310-4746-8e36-afd7c6dd2895","login":"test","email":"test@example.com","created":"2016-02-15T18:18:13.000Z"}`))
+	})
+	defer done()
+
+	account, err := client.GetAccount(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "test", account.Login)
+	assert.Equal(t, "test@example.com", account.Email)
+	assert.Equal(t, 2016, account.Created.Year())
+}
+
+func TestCreateKey(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/test/keys", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var input CreateKeyInput
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &input))
+		assert.Equal(t, "docker-machine", input.Name)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&Key{Name: input.Name, Key: input.Key, Fingerprint: "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42"})
+	})
+	defer done()
+
+	key, err := client.CreateKey(context.Background(), &CreateKeyInput{Name: "docker-machine", Key: "ssh-rsa AAAA"})
+	assert.Nil(t, err)
+	assert.Equal(t, "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", key.Fingerprint)
+}
+
+func TestError(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-request-id", "3e9ab1a0-d6e4-11e5-8e3f-7b4e2e57b1f1")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"code":"NotAuthorized","message":"You do not have permission to access /test/keys"}`))
+	})
+	defer done()
+
+	_, err := client.ListKeys(context.Background())
+	assert.NotNil(t, err)
+
+	apiErr, ok := err.(*Error)
+	assert.True(t, ok, "Not a CloudAPI error")
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, "NotAuthorized", apiErr.Code)
+	assert.Equal(t, "3e9ab1a0-d6e4-11e5-8e3f-7b4e2e57b1f1", apiErr.RequestId)
+	assert.Equal(t, "ERROR: CloudAPI GET keys failed: You do not have permission to access /test/keys (NotAuthorized) [request-id 3e9ab1a0-d6e4-11e5-8e3f-7b4e2e57b1f1]", err.Error())
+	assert.Equal(t, http.StatusForbidden, StatusCode(err))
+	assert.False(t, IsNotFound(err))
+}
+
+func TestErrorWithoutBody(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	defer done()
+
+	_, err := client.GetMachine(context.Background(), "cc71f8bb-f310-4746-8e36-afd7c6dd2895")
+	assert.NotNil(t, err)
+	assert.Equal(t, "ERROR: CloudAPI GET machines/cc71f8bb-f310-4746-8e36-afd7c6dd2895 failed: Gone", err.Error())
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, 0, StatusCode(errors.New("connection refused")))
+}
+
+func TestInvalidResponse(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["not", "a", "map"]`))
+	})
+	defer done()
+
+	_, err := client.ListDatacenters(context.Background())
+	assert.NotNil(t, err, "Accepted an undecodable response")
+}
+
+func TestCanceledContext(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.ListServices(ctx)
+	assert.NotNil(t, err, "Sent a request with a canceled context")
+	assert.Equal(t, 0, StatusCode(err))
+}
+
+func TestRole(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "operators,docker", r.URL.Query().Get("as-role"))
+		assert.Equal(t, "ubuntu-16.04", r.URL.Query().Get("name"))
+		w.Write([]byte(`[]`))
+	})
+	defer done()
+	client.Role = "operators,docker"
+
+	_, err := client.ListImages(context.Background(), &ListImagesInput{Name: "ubuntu-16.04"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,27 @@
+package cloudapi
+
+import (
+	"context"
+)
+
+// ListServices returns the URLs of the services (e.g. "docker") offered in
+// the datacenter, keyed by service name.
+func (c *Client) ListServices(ctx context.Context) (map[string]string, error) {
+	var services map[string]string
+	_, err := c.do(ctx, "GET", "services", nil, nil, &services)
+	if err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// ListDatacenters returns the CloudAPI URLs of the datacenters of the
+// cloud, keyed by datacenter name.
+func (c *Client) ListDatacenters(ctx context.Context) (map[string]string, error) {
+	var datacenters map[string]string
+	_, err := c.do(ctx, "GET", "datacenters", nil, nil, &datacenters)
+	if err != nil {
+		return nil, err
+	}
+	return datacenters, nil
+}
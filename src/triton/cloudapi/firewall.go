@@ -0,0 +1,81 @@
+package cloudapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// FirewallRule is a Cloud Firewall rule of the account, e.g.
+// "FROM any TO tag role = docker ALLOW tcp PORT 2376".
+type FirewallRule struct {
+	Id          string `json:"id"`
+	Enabled     bool   `json:"enabled"`
+	Rule        string `json:"rule"`
+	Global      bool   `json:"global"`
+	Description string `json:"description"`
+}
+
+// FirewallRuleInput describes a rule to create or the new values of a rule
+// to update.
+type FirewallRuleInput struct {
+	Enabled     bool   `json:"enabled"`
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListFirewallRules returns the account's firewall rules.
+func (c *Client) ListFirewallRules(ctx context.Context) ([]*FirewallRule, error) {
+	var rules []*FirewallRule
+	_, err := c.do(ctx, "GET", "fwrules", nil, nil, &rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ListMachineFirewallRules returns the firewall rules that apply to the
+// machine with the given id.
+func (c *Client) ListMachineFirewallRules(ctx context.Context, machineId string) ([]*FirewallRule, error) {
+	var rules []*FirewallRule
+	_, err := c.do(ctx, "GET", "machines/"+url.PathEscape(machineId)+"/fwrules", nil, nil, &rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetFirewallRule returns the firewall rule with the given id.
+func (c *Client) GetFirewallRule(ctx context.Context, id string) (*FirewallRule, error) {
+	var rule FirewallRule
+	_, err := c.do(ctx, "GET", "fwrules/"+url.PathEscape(id), nil, nil, &rule)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateFirewallRule adds a firewall rule to the account.
+func (c *Client) CreateFirewallRule(ctx context.Context, input *FirewallRuleInput) (*FirewallRule, error) {
+	var rule FirewallRule
+	_, err := c.do(ctx, "POST", "fwrules", nil, input, &rule)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateFirewallRule replaces the firewall rule with the given id.
+func (c *Client) UpdateFirewallRule(ctx context.Context, id string, input *FirewallRuleInput) (*FirewallRule, error) {
+	var rule FirewallRule
+	_, err := c.do(ctx, "POST", "fwrules/"+url.PathEscape(id), nil, input, &rule)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// DeleteFirewallRule removes the firewall rule with the given id.
+func (c *Client) DeleteFirewallRule(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", "fwrules/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
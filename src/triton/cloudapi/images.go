@@ -0,0 +1,70 @@
+package cloudapi
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Image is a machine image.
+type Image struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	OS          string            `json:"os"`
+	Type        string            `json:"type"`
+	Description string            `json:"description"`
+	State       string            `json:"state"`
+	Public      bool              `json:"public"`
+	Owner       string            `json:"owner"`
+	Tags        map[string]string `json:"tags"`
+	PublishedAt time.Time         `json:"published_at"`
+}
+
+// ListImagesInput filters the images returned by ListImages. Empty fields
+// don't filter.
+type ListImagesInput struct {
+	Name    string
+	Version string
+	OS      string
+	Type    string
+	State   string
+	Owner   string
+	// Public restricts the list to public (true) or private (false)
+	// images when set.
+	Public *bool
+}
+
+// ListImages returns the images available to the account.
+func (c *Client) ListImages(ctx context.Context, input *ListImagesInput) ([]*Image, error) {
+	query := url.Values{}
+	if input != nil {
+		setString(query, "name", input.Name)
+		setString(query, "version", input.Version)
+		setString(query, "os", input.OS)
+		setString(query, "type", input.Type)
+		setString(query, "state", input.State)
+		setString(query, "owner", input.Owner)
+		if input.Public != nil {
+			query.Set("public", strconv.FormatBool(*input.Public))
+		}
+	}
+
+	var images []*Image
+	_, err := c.do(ctx, "GET", "images", query, nil, &images)
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// GetImage returns the image with the given id.
+func (c *Client) GetImage(ctx context.Context, id string) (*Image, error) {
+	var image Image
+	_, err := c.do(ctx, "GET", "images/"+url.PathEscape(id), nil, nil, &image)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
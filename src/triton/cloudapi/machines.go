@@ -0,0 +1,170 @@
+package cloudapi
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Machine is a Triton instance.
+type Machine struct {
+	Id              string            `json:"id"`
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	Brand           string            `json:"brand"`
+	State           string            `json:"state"`
+	Image           string            `json:"image"`
+	Package         string            `json:"package"`
+	Memory          int               `json:"memory"`
+	Disk            int               `json:"disk"`
+	Ips             []string          `json:"ips"`
+	PrimaryIp       string            `json:"primaryIp"`
+	Networks        []string          `json:"networks"`
+	Metadata        map[string]string `json:"metadata"`
+	Tags            map[string]string `json:"tags"`
+	FirewallEnabled bool              `json:"firewall_enabled"`
+	ComputeNode     string            `json:"compute_node"`
+	Docker          bool              `json:"docker"`
+	Created         time.Time         `json:"created"`
+	Updated         time.Time         `json:"updated"`
+}
+
+// ListMachinesInput filters the machines returned by ListMachines. Empty
+// fields don't filter.
+type ListMachinesInput struct {
+	Name    string
+	Image   string
+	Package string
+	State   string
+	Type    string
+	Tags    map[string]string
+}
+
+// ListMachines returns the account's machines, fetching as many pages as
+// needed.
+func (c *Client) ListMachines(ctx context.Context, input *ListMachinesInput) ([]*Machine, error) {
+	query := url.Values{}
+	if input != nil {
+		setString(query, "name", input.Name)
+		setString(query, "image", input.Image)
+		setString(query, "package", input.Package)
+		setString(query, "state", input.State)
+		setString(query, "type", input.Type)
+		for k, v := range input.Tags {
+			query.Set("tag."+k, v)
+		}
+	}
+
+	limit := c.pageSize()
+	query.Set("limit", strconv.Itoa(limit))
+
+	var machines []*Machine
+	for {
+		query.Set("offset", strconv.Itoa(len(machines)))
+
+		var page []*Machine
+		header, err := c.do(ctx, "GET", "machines", query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, page...)
+
+		// CloudAPI reports the total number of matches, fall back to
+		// stopping at the first short page when it doesn't.
+		total, err := strconv.Atoi(header.Get("x-resource-count"))
+		if err != nil {
+			total = -1
+		}
+		if len(page) == 0 || len(page) < limit || len(machines) == total {
+			return machines, nil
+		}
+	}
+}
+
+// GetMachine returns the machine with the given id.
+func (c *Client) GetMachine(ctx context.Context, id string) (*Machine, error) {
+	var machine Machine
+	_, err := c.do(ctx, "GET", "machines/"+url.PathEscape(id), nil, nil, &machine)
+	if err != nil {
+		return nil, err
+	}
+	return &machine, nil
+}
+
+// CreateMachineInput describes a machine to provision.
+type CreateMachineInput struct {
+	Name    string
+	Image   string
+	Package string
+	// Networks the machine is attached to, the defaults when empty.
+	Networks        []string
+	Metadata        map[string]string
+	Tags            map[string]string
+	FirewallEnabled bool
+}
+
+// toBody returns the CreateMachine request body, in which metadata and
+// tags are flattened into "metadata.<key>" and "tag.<key>" fields.
+func (input *CreateMachineInput) toBody() map[string]interface{} {
+	body := map[string]interface{}{
+		"image":   input.Image,
+		"package": input.Package,
+	}
+	if input.Name != "" {
+		body["name"] = input.Name
+	}
+	if len(input.Networks) > 0 {
+		body["networks"] = input.Networks
+	}
+	if input.FirewallEnabled {
+		body["firewall_enabled"] = true
+	}
+	for k, v := range input.Metadata {
+		body["metadata."+k] = v
+	}
+	for k, v := range input.Tags {
+		body["tag."+k] = v
+	}
+	return body
+}
+
+// CreateMachine starts provisioning a machine. The returned machine is
+// usually still in the "provisioning" state.
+func (c *Client) CreateMachine(ctx context.Context, input *CreateMachineInput) (*Machine, error) {
+	var machine Machine
+	_, err := c.do(ctx, "POST", "machines", nil, input.toBody(), &machine)
+	if err != nil {
+		return nil, err
+	}
+	return &machine, nil
+}
+
+// DeleteMachine starts deleting the machine with the given id.
+func (c *Client) DeleteMachine(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", "machines/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+// MachineAction requests a state change ("start", "stop", "reboot") of
+// the machine with the given id.
+func (c *Client) MachineAction(ctx context.Context, id string, action string) error {
+	query := url.Values{"action": []string{action}}
+	_, err := c.do(ctx, "POST", "machines/"+url.PathEscape(id), query, nil, nil)
+	return err
+}
+
+// StartMachine starts a stopped machine.
+func (c *Client) StartMachine(ctx context.Context, id string) error {
+	return c.MachineAction(ctx, id, "start")
+}
+
+// StopMachine stops a running machine.
+func (c *Client) StopMachine(ctx context.Context, id string) error {
+	return c.MachineAction(ctx, id, "stop")
+}
+
+// RebootMachine reboots a running machine.
+func (c *Client) RebootMachine(ctx context.Context, id string) error {
+	return c.MachineAction(ctx, id, "reboot")
+}
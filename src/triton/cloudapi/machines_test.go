@@ -0,0 +1,131 @@
+package cloudapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListMachinesPagination(t *testing.T) {
+	var offsets []string
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/test/machines", r.URL.Path)
+		assert.Equal(t, "running", r.URL.Query().Get("state"))
+		assert.Equal(t, "docker", r.URL.Query().Get("tag.role"))
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+
+		var page []*Machine
+		for i := offset; i < offset+2 && i < 5; i++ {
+			page = append(page, &Machine{Id: fmt.Sprintf("machine-%d", i), State: "running"})
+		}
+		w.Header().Set("x-resource-count", "5")
+		json.NewEncoder(w).Encode(page)
+	})
+	defer done()
+	client.PageSize = 2
+
+	machines, err := client.ListMachines(context.Background(), &ListMachinesInput{
+		State: "running",
+		Tags:  map[string]string{"role": "docker"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0", "2", "4"}, offsets)
+	assert.Len(t, machines, 5)
+	assert.Equal(t, "machine-4", machines[4].Id)
+}
+
+func TestListMachinesFullLastPage(t *testing.T) {
+	requests := 0
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-resource-count", "2")
+		w.Write([]byte(`[{"id":"machine-0"},{"id":"machine-1"}]`))
+	})
+	defer done()
+	client.PageSize = 2
+
+	machines, err := client.ListMachines(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Len(t, machines, 2)
+	assert.Equal(t, 1, requests, "Fetched a page past the resource count")
+}
+
+func TestCreateMachine(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/test/machines", r.URL.Path)
+
+		var body map[string]interface{}
+		data, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(data, &body))
+		assert.Equal(t, map[string]interface{}{
+			"name":             "docker-1",
+			"image":            "2d2f4a86-d6e4-11e5-a1a1-6f6a3b5b3b5b",
+			"package":          "g4-highcpu-1G",
+			"networks":         []interface{}{"public"},
+			"firewall_enabled": true,
+			"metadata.user":    "root",
+			"tag.role":         "docker",
+		}, body)
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"cc71f8bb-f310-4746-8e36-afd7c6dd2895","name":"docker-1","state":"provisioning"}`))
+	})
+	defer done()
+
+	machine, err := client.CreateMachine(context.Background(), &CreateMachineInput{
+		Name:            "docker-1",
+		Image:           "2d2f4a86-d6e4-11e5-a1a1-6f6a3b5b3b5b",
+		Package:         "g4-highcpu-1G",
+		Networks:        []string{"public"},
+		Metadata:        map[string]string{"user": "root"},
+		Tags:            map[string]string{"role": "docker"},
+		FirewallEnabled: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "cc71f8bb-f310-4746-8e36-afd7c6dd2895", machine.Id)
+	assert.Equal(t, "provisioning", machine.State)
+}
+
+func TestMachineActions(t *testing.T) {
+	var actions []string
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/test/machines/cc71f8bb-f310-4746-8e36-afd7c6dd2895", r.URL.Path)
+		actions = append(actions, r.URL.Query().Get("action"))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	defer done()
+
+	ctx := context.Background()
+	assert.Nil(t, client.StopMachine(ctx, "cc71f8bb-f310-4746-8e36-afd7c6dd2895"))
+	assert.Nil(t, client.StartMachine(ctx, "cc71f8bb-f310-4746-8e36-afd7c6dd2895"))
+	assert.Nil(t, client.RebootMachine(ctx, "cc71f8bb-f310-4746-8e36-afd7c6dd2895"))
+	assert.Equal(t, []string{"stop", "start", "reboot"}, actions)
+}
+
+func TestListImages(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/test/images", r.URL.Path)
+		assert.Equal(t, "ubuntu-16.04", r.URL.Query().Get("name"))
+		assert.Equal(t, "true", r.URL.Query().Get("public"))
+		w.Write([]byte(`[{"id":"2d2f4a86-d6e4-11e5-a1a1-6f6a3b5b3b5b","name":"ubuntu-16.04","version":"20160215","public":true,"published_at":"2016-02-15T18:18:13Z"}]`))
+	})
+	defer done()
+
+	public := true
+	images, err := client.ListImages(context.Background(), &ListImagesInput{Name: "ubuntu-16.04", Public: &public})
+	assert.Nil(t, err)
+	assert.Len(t, images, 1)
+	assert.Equal(t, "20160215", images[0].Version)
+	assert.Equal(t, 2016, images[0].PublishedAt.Year())
+}
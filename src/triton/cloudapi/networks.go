@@ -0,0 +1,41 @@
+package cloudapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// Network is a network machines can be attached to.
+type Network struct {
+	Id               string   `json:"id"`
+	Name             string   `json:"name"`
+	Public           bool     `json:"public"`
+	Fabric           bool     `json:"fabric"`
+	Description      string   `json:"description"`
+	Subnet           string   `json:"subnet"`
+	ProvisionStartIp string   `json:"provision_start_ip"`
+	ProvisionEndIp   string   `json:"provision_end_ip"`
+	Gateway          string   `json:"gateway"`
+	Resolvers        []string `json:"resolvers"`
+	VLANId           int      `json:"vlan_id"`
+}
+
+// ListNetworks returns the networks available to the account.
+func (c *Client) ListNetworks(ctx context.Context) ([]*Network, error) {
+	var networks []*Network
+	_, err := c.do(ctx, "GET", "networks", nil, nil, &networks)
+	if err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+// GetNetwork returns the network with the given id.
+func (c *Client) GetNetwork(ctx context.Context, id string) (*Network, error) {
+	var network Network
+	_, err := c.do(ctx, "GET", "networks/"+url.PathEscape(id), nil, nil, &network)
+	if err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
@@ -0,0 +1,56 @@
+package cloudapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// Package is a machine size (memory, disk, CPU) offered by the cloud.
+type Package struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Memory      int    `json:"memory"`
+	Disk        int    `json:"disk"`
+	Swap        int    `json:"swap"`
+	VCPUs       int    `json:"vcpus"`
+	LWPs        int    `json:"lwps"`
+	Version     string `json:"version"`
+	Group       string `json:"group"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+// ListPackagesInput filters the packages returned by ListPackages. Empty
+// fields don't filter.
+type ListPackagesInput struct {
+	Name    string
+	Version string
+	Group   string
+}
+
+// ListPackages returns the packages available to the account.
+func (c *Client) ListPackages(ctx context.Context, input *ListPackagesInput) ([]*Package, error) {
+	query := url.Values{}
+	if input != nil {
+		setString(query, "name", input.Name)
+		setString(query, "version", input.Version)
+		setString(query, "group", input.Group)
+	}
+
+	var packages []*Package
+	_, err := c.do(ctx, "GET", "packages", query, nil, &packages)
+	if err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// GetPackage returns the package with the given name or id.
+func (c *Client) GetPackage(ctx context.Context, name string) (*Package, error) {
+	var pkg Package
+	_, err := c.do(ctx, "GET", "packages/"+url.PathEscape(name), nil, nil, &pkg)
+	if err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
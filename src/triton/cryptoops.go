@@ -2,37 +2,41 @@ package triton
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	_ "crypto/sha512"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 
-	"github.com/yosida95/golang-sshkey"
+	"golang.org/x/crypto/ssh"
 )
 
 //
 // Public key methods
 //
-func GetSshKey(path string) (sshkey.PublicKey, error) {
-	// try to load ssh public key from path
-	keyData, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	return sshkey.UnmarshalPublicKey(string(keyData))
 
+// GetSshKey loads an OpenSSH (authorized_keys format) public key.
+func GetSshKey(path string) (ssh.PublicKey, error) {
+	return LoadSshPublicKey(path)
 }
 
-func GetSshKeyFingerprint(key sshkey.PublicKey) (string, error) {
-	return sshkey.PrettyFingerprint(key, crypto.MD5)
+// GetSshKeyFingerprint returns the MD5 fingerprint of key, see
+// KeyIdFingerprint for the SHA-256 one.
+func GetSshKeyFingerprint(key ssh.PublicKey) (string, error) {
+	return KeyIdFingerprint(key, KeyIdFormatMD5)
 }
 
+// GetSshKeyId returns the MD5 fingerprint of the public key file.
 func GetSshKeyId(path string) (string, error) {
 	key, err := GetSshKey(path)
 	if err != nil {
@@ -43,8 +47,8 @@ func GetSshKeyId(path string) (string, error) {
 }
 
 // http://stackoverflow.com/questions/20655702/signing-and-decoding-with-rsa-sha-in-go
-// loadPrivateKey loads an parses a PEM encoded private key file.
-func LoadPublicKey(path string) (Unsigner, error) {
+// LoadPublicKey loads and parses a PEM encoded or OpenSSH public key file.
+func LoadPublicKey(path string) (Verifier, error) {
 	data, err := ioutil.ReadFile(path)
 
 	if err != nil {
@@ -53,51 +57,112 @@ func LoadPublicKey(path string) (Unsigner, error) {
 	return parsePublicKey(data)
 }
 
-// parsePublicKey parses a PEM encoded private key.
-func parsePublicKey(pemBytes []byte) (Unsigner, error) {
+// parsePublicKey parses a PEM encoded or OpenSSH (authorized_keys format)
+// public key.
+func parsePublicKey(pemBytes []byte) (Verifier, error) {
 	block, _ := pem.Decode(pemBytes)
 	if block == nil {
-		return nil, errors.New("ssh: no key found")
+		sshKey, _, _, _, err := ssh.ParseAuthorizedKey(pemBytes)
+		if err != nil {
+			return nil, errors.New("ssh: no key found")
+		}
+		return newVerifierFromSshKey(sshKey)
 	}
 
 	var rawkey interface{}
 	switch block.Type {
 	case "PUBLIC KEY":
-		rsa, err := x509.ParsePKIXPublicKey(block.Bytes)
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
 		if err != nil {
 			return nil, err
 		}
-		rawkey = rsa
+		rawkey = key
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rawkey = key
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %q", block.Type)
 	}
 
-	return newUnsignerFromKey(rawkey)
+	return newVerifierFromKey(rawkey)
 }
 
+// newVerifierFromSshKey returns a Verifier for an SSH public key.
+func newVerifierFromSshKey(key ssh.PublicKey) (Verifier, error) {
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("ssh: unsupported key type %q", key.Type())
+	}
+	return newVerifierFromKey(cryptoKey.CryptoPublicKey())
+}
+
+// ErrPassphraseRequired is returned when loading an encrypted private key
+// without a passphrase.
+var ErrPassphraseRequired = errors.New("ssh: the private key is encrypted, a passphrase is required")
+
 // loadPrivateKey loads an parses a PEM encoded private key file.
 func LoadPrivateKey(path string, password string) (Signer, error) {
+	rawkey, err := LoadRawPrivateKey(path, password)
+	if err != nil {
+		return nil, err
+	}
+	return newSignerFromKey(rawkey)
+}
+
+// LoadRawPrivateKey loads and parses a PEM encoded private key file,
+// returning the underlying crypto key (e.g. *rsa.PrivateKey).
+func LoadRawPrivateKey(path string, password string) (interface{}, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return parsePrivateKey(data, password)
+	return parseRawPrivateKey(data, password)
 }
 
-// parsePublicKey parses a PEM encoded private key.
+// parsePrivateKey parses a PEM encoded private key.
 func parsePrivateKey(pemBytes []byte, password string) (Signer, error) {
+	rawkey, err := parseRawPrivateKey(pemBytes, password)
+	if err != nil {
+		return nil, err
+	}
+	return newSignerFromKey(rawkey)
+}
+
+// parseRawPrivateKey parses a PEM encoded private key into a crypto key.
+// Besides the traditional "RSA PRIVATE KEY" and "EC PRIVATE KEY" blocks,
+// OpenSSH ("OPENSSH PRIVATE KEY") and PKCS#8 ("PRIVATE KEY" and
+// "ENCRYPTED PRIVATE KEY") keys are accepted.
+func parseRawPrivateKey(pemBytes []byte, password string) (interface{}, error) {
 	var buf []byte
 	block, _ := pem.Decode(pemBytes)
 
 	if block == nil {
 		return nil, errors.New("ssh: no key found")
 	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(pemBytes, password)
+	case "PRIVATE KEY":
+		return parsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return nil, ErrPassphraseRequired
+		}
+		der, err := decryptPKCS8(block.Bytes, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS8PrivateKey(der)
+	}
+
 	// check if we have an ecrypted pem Block
 	if x509.IsEncryptedPEMBlock(block) {
 		if password == "" {
-			fmt.Printf("Enter password:")
-			fmt.Scanln(&password)
-
+			return nil, ErrPassphraseRequired
 		}
 		blk, err := x509.DecryptPEMBlock(block, []byte(password))
 		if err != nil {
@@ -111,18 +176,33 @@ func parsePrivateKey(pemBytes []byte, password string) (Signer, error) {
 		copy(buf, block.Bytes)
 	}
 
-	var rawkey interface{}
 	switch block.Type {
 	case "RSA PRIVATE KEY":
-		rsa, err := x509.ParsePKCS1PrivateKey(buf)
-		if err != nil {
-			return nil, err
-		}
-		rawkey = rsa
+		return x509.ParsePKCS1PrivateKey(buf)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(buf)
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %q", block.Type)
 	}
-	return newSignerFromKey(rawkey)
+}
+
+// parseOpenSSHPrivateKey parses a key in the OpenSSH format written by
+// default by ssh-keygen, including bcrypt encrypted ones.
+func parseOpenSSHPrivateKey(pemBytes []byte, password string) (interface{}, error) {
+	var key interface{}
+	var err error
+	if password == "" {
+		key, err = ssh.ParseRawPrivateKey(pemBytes)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			return nil, ErrPassphraseRequired
+		}
+	} else {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, []byte(password))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizePrivateKey(key), nil
 }
 
 // A Signer is can create signatures that verify against a public key.
@@ -131,13 +211,19 @@ type Signer interface {
 	// will apply the hash specified for the keytype to the data.
 	Sign(data []byte) ([]byte, error)
 	SignToString(data []byte) (string, error)
+	// Algorithm returns the http-signature algorithm name of the
+	// signatures, e.g. "rsa-sha256".
+	Algorithm() string
 }
 
-// A Signer is can create signatures that verify against a public key.
-type Unsigner interface {
-	// Sign returns raw signature for the given data. This method
+// A Verifier checks signatures made by the matching Signer.
+type Verifier interface {
+	// Verify checks that sig is a valid signature of data. This method
 	// will apply the hash specified for the keytype to the data.
-	Unsign(data []byte) ([]byte, error)
+	Verify(data []byte, sig []byte) error
+	// Algorithm returns the http-signature algorithm name of the
+	// signatures, e.g. "rsa-sha256".
+	Algorithm() string
 }
 
 func newSignerFromKey(k interface{}) (Signer, error) {
@@ -145,17 +231,33 @@ func newSignerFromKey(k interface{}) (Signer, error) {
 	switch t := k.(type) {
 	case *rsa.PrivateKey:
 		sshKey = &rsaPrivateKey{t}
+	case *ecdsa.PrivateKey:
+		hash, err := ecdsaHash(t.Curve)
+		if err != nil {
+			return nil, err
+		}
+		sshKey = &ecdsaPrivateKey{t, hash}
+	case ed25519.PrivateKey:
+		sshKey = &ed25519PrivateKey{t}
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %T", k)
 	}
 	return sshKey, nil
 }
 
-func newUnsignerFromKey(k interface{}) (Unsigner, error) {
-	var sshKey Unsigner
+func newVerifierFromKey(k interface{}) (Verifier, error) {
+	var sshKey Verifier
 	switch t := k.(type) {
 	case *rsa.PublicKey:
 		sshKey = &rsaPublicKey{t}
+	case *ecdsa.PublicKey:
+		hash, err := ecdsaHash(t.Curve)
+		if err != nil {
+			return nil, err
+		}
+		sshKey = &ecdsaPublicKey{t, hash}
+	case ed25519.PublicKey:
+		sshKey = &ed25519PublicKey{t}
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %T", k)
 	}
@@ -186,10 +288,142 @@ func (r *rsaPrivateKey) SignToString(data []byte) (string, error) {
 	}
 }
 
-func (r *rsaPublicKey) Unsign(message []byte) ([]byte, error) {
+func (r *rsaPrivateKey) Algorithm() string {
+	return "rsa-sha256"
+}
+
+type ecdsaPrivateKey struct {
+	*ecdsa.PrivateKey
+	hash crypto.Hash
+}
+
+// ecdsaHash returns the hash used with a curve, following the SSH
+// ecdsa-sha2-nistp* key types.
+func ecdsaHash(curve elliptic.Curve) (crypto.Hash, error) {
+	switch curve.Params().BitSize {
+	case 256:
+		return crypto.SHA256, nil
+	case 384:
+		return crypto.SHA384, nil
+	case 521:
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("ssh: unsupported ecdsa curve %s", curve.Params().Name)
+	}
+}
+
+// ecdsaSignature is the ASN.1 (DER) form of an ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Sign signs data with ecdsa-sha256/384/512 depending on the curve and
+// returns the DER encoded signature.
+func (e *ecdsaPrivateKey) Sign(data []byte) ([]byte, error) {
+	h := e.hash.New()
+	h.Write(data)
+	d := h.Sum(nil)
+	r, s, err := ecdsa.Sign(rand.Reader, e.PrivateKey, d)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ecdsaSignature{r, s})
+}
+
+func (e *ecdsaPrivateKey) SignToString(data []byte) (string, error) {
+	sig, err := e.Sign(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (e *ecdsaPrivateKey) Algorithm() string {
+	switch e.hash {
+	case crypto.SHA384:
+		return "ecdsa-sha384"
+	case crypto.SHA512:
+		return "ecdsa-sha512"
+	default:
+		return "ecdsa-sha256"
+	}
+}
+
+type ed25519PrivateKey struct {
+	ed25519.PrivateKey
+}
+
+// Sign signs data with ed25519 (which does its own hashing).
+func (e *ed25519PrivateKey) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(e.PrivateKey, data), nil
+}
+
+func (e *ed25519PrivateKey) SignToString(data []byte) (string, error) {
+	sig, err := e.Sign(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Algorithm returns "ed25519-sha512", as CloudAPI (node-http-signature)
+// only accepts algorithms of the form <key>-<hash>.
+func (e *ed25519PrivateKey) Algorithm() string {
+	return "ed25519-sha512"
+}
+
+// Verify checks an rsa-sha256 signature
+func (r *rsaPublicKey) Verify(message []byte, sig []byte) error {
 	h := sha256.New()
 	h.Write(message)
 	d := h.Sum(nil)
-	return d, nil
-	//return rsa.VerifyPKCS1v15(r.PublicKey, crypto.SHA256, d, sig)
+	return rsa.VerifyPKCS1v15(r.PublicKey, crypto.SHA256, d, sig)
+}
+
+func (r *rsaPublicKey) Algorithm() string {
+	return "rsa-sha256"
+}
+
+type ecdsaPublicKey struct {
+	*ecdsa.PublicKey
+	hash crypto.Hash
+}
+
+// Verify checks a DER encoded ecdsa-sha256/384/512 signature.
+func (e *ecdsaPublicKey) Verify(message []byte, sig []byte) error {
+	var ecSig ecdsaSignature
+	rest, err := asn1.Unmarshal(sig, &ecSig)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 || ecSig.R == nil || ecSig.S == nil {
+		return errors.New("ssh: invalid ecdsa signature")
+	}
+
+	h := e.hash.New()
+	h.Write(message)
+	if !ecdsa.Verify(e.PublicKey, h.Sum(nil), ecSig.R, ecSig.S) {
+		return errors.New("ssh: ecdsa signature verification failed")
+	}
+	return nil
+}
+
+func (e *ecdsaPublicKey) Algorithm() string {
+	return (&ecdsaPrivateKey{hash: e.hash}).Algorithm()
+}
+
+type ed25519PublicKey struct {
+	ed25519.PublicKey
+}
+
+// Verify checks an ed25519 signature.
+func (e *ed25519PublicKey) Verify(message []byte, sig []byte) error {
+	if !ed25519.Verify(e.PublicKey, message, sig) {
+		return errors.New("ssh: ed25519 signature verification failed")
+	}
+	return nil
+}
+
+func (e *ed25519PublicKey) Algorithm() string {
+	return "ed25519-sha512"
 }
@@ -1,7 +1,15 @@
 package triton
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
 	"os"
 	"testing"
 )
@@ -71,3 +79,142 @@ func TestEncryptMessageWithPasswordProtectedCert(t *testing.T) {
 
 	assert.Equal(t, out_data, data, "Result don't match!")
 }
+
+func TestAlgorithm(t *testing.T) {
+	signer, err := LoadPrivateKey("../../fixup/id_rsa", "")
+
+	assert.Nil(t, err, "Can't load private key")
+
+	assert.Equal(t, "rsa-sha256", signer.Algorithm())
+}
+
+func TestSignMessageEcdsa(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+	ssh_private_key_path := "../../fixup/id_ecdsa"
+
+	key, err := LoadRawPrivateKey(ssh_private_key_path, "")
+
+	assert.Nil(t, err, "Can't load private key")
+
+	signer, err := newSignerFromKey(key)
+
+	assert.Nil(t, err, "Can't create signer")
+	assert.Equal(t, "ecdsa-sha256", signer.Algorithm())
+
+	data, err := signer.Sign([]byte(in_data))
+
+	assert.Nil(t, err, "Error on signing the message")
+
+	var sig ecdsaSignature
+	_, err = asn1.Unmarshal(data, &sig)
+
+	assert.Nil(t, err, "Signature is not DER encoded")
+
+	digest := sha256.Sum256([]byte(in_data))
+	pub := &key.(*ecdsa.PrivateKey).PublicKey
+	assert.True(t, ecdsa.Verify(pub, digest[:], sig.R, sig.S), "Signature doesn't verify")
+}
+
+func TestSignMessageEd25519(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+
+	assert.Nil(t, err, "Can't generate ed25519 key")
+
+	signer, err := newSignerFromKey(key)
+
+	assert.Nil(t, err, "Can't create signer")
+	assert.Equal(t, "ed25519-sha512", signer.Algorithm())
+
+	data, err := signer.SignToString([]byte(in_data))
+
+	assert.Nil(t, err, "Error on signing the message")
+
+	sig, err := base64.StdEncoding.DecodeString(data)
+
+	assert.Nil(t, err, "Signature is not base64 encoded")
+	assert.True(t, ed25519.Verify(pub, []byte(in_data), sig), "Signature doesn't verify")
+}
+
+func TestEncryptMessagePKCS8(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+	out_data := "B0qFg0BQzLALM5uVxo01bZ4NcZEc4IfWSrAtuC/5cQiYDSl/9HbhXcwpC3ylToW5d9urs8oSTSf7kAI/oqYTzy+7cFzdOs1qiwNdiz5noyQkuW9kxe3Yi1H2qolzSZj5ila1eqnDzE+sUORNl/EuO8kxMwGSs6TCMYQvV6tuo4ecnhd4M5rrYgjpZSvacQ+Ng+zgv5FYVtLs8EbyL9A/80Cc9dmDsCd9EKTOmCIgNFSQFx3K8igv8BGWpzafvlakmA6TcoJ+QdGtlslxw1wwdhP61BEUr9h4MtFj+EfO8C7LF00/9tbAUN71a7XEY6pu8cKuX1TBAppMRZjuQ9b0Fg=="
+	ssh_private_key_path := "../../fixup/id_rsa.pkcs8"
+
+	signer, err := LoadPrivateKey(ssh_private_key_path, "")
+
+	assert.Nil(t, err, "Can't load private key")
+
+	data, err := signer.SignToString([]byte(in_data))
+
+	assert.Nil(t, err, "Error on signing the message")
+
+	assert.Equal(t, out_data, data, "Result don't match!")
+}
+
+func TestEncryptMessageEncryptedPKCS8(t *testing.T) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+	out_data := "B0qFg0BQzLALM5uVxo01bZ4NcZEc4IfWSrAtuC/5cQiYDSl/9HbhXcwpC3ylToW5d9urs8oSTSf7kAI/oqYTzy+7cFzdOs1qiwNdiz5noyQkuW9kxe3Yi1H2qolzSZj5ila1eqnDzE+sUORNl/EuO8kxMwGSs6TCMYQvV6tuo4ecnhd4M5rrYgjpZSvacQ+Ng+zgv5FYVtLs8EbyL9A/80Cc9dmDsCd9EKTOmCIgNFSQFx3K8igv8BGWpzafvlakmA6TcoJ+QdGtlslxw1wwdhP61BEUr9h4MtFj+EfO8C7LF00/9tbAUN71a7XEY6pu8cKuX1TBAppMRZjuQ9b0Fg=="
+	ssh_private_key_path := "../../fixup/pass_id_rsa.pkcs8"
+
+	signer, err := LoadPrivateKey(ssh_private_key_path, "testing")
+
+	assert.Nil(t, err, "Can't load private key")
+
+	data, err := signer.SignToString([]byte(in_data))
+
+	assert.Nil(t, err, "Error on signing the message")
+
+	assert.Equal(t, out_data, data, "Result don't match!")
+}
+
+func TestLoadEncryptedPKCS8WithWrongPassword(t *testing.T) {
+	_, err := LoadPrivateKey("../../fixup/pass_id_rsa.pkcs8", "wrong")
+
+	assert.NotNil(t, err, "Loaded key with the wrong password")
+}
+
+func checkOpenSSHKey(t *testing.T, ssh_private_key_path string, password string) {
+	in_data := "Mon, 15 Feb 2016 18:18:13 GMT"
+
+	signer, err := LoadPrivateKey(ssh_private_key_path, password)
+
+	assert.Nil(t, err, "Can't load private key")
+	assert.Equal(t, "ed25519-sha512", signer.Algorithm())
+
+	sig, err := signer.Sign([]byte(in_data))
+
+	assert.Nil(t, err, "Error on signing the message")
+
+	pubData, err := ioutil.ReadFile(ssh_private_key_path + ".pub")
+
+	assert.Nil(t, err, "public key file does not exist")
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(pubData)
+
+	assert.Nil(t, err, "invalid public key")
+
+	cryptoPub := pub.(ssh.CryptoPublicKey).CryptoPublicKey().(ed25519.PublicKey)
+	assert.True(t, ed25519.Verify(cryptoPub, []byte(in_data), sig), "Signature doesn't verify")
+}
+
+func TestLoadOpenSSHPrivateKey(t *testing.T) {
+	checkOpenSSHKey(t, "../../fixup/id_ed25519", "")
+}
+
+func TestLoadOpenSSHPrivateKeyWithPassword(t *testing.T) {
+	checkOpenSSHKey(t, "../../fixup/pass_id_ed25519", "testing")
+}
+
+func TestLoadEncryptedKeysWithoutPassphrase(t *testing.T) {
+	for _, ssh_private_key_path := range []string{
+		"../../fixup/pass_id_rsa",
+		"../../fixup/pass_id_rsa.pkcs8",
+		"../../fixup/pass_id_ed25519",
+	} {
+		_, err := LoadPrivateKey(ssh_private_key_path, "")
+
+		assert.Equal(t, ErrPassphraseRequired, err, ssh_private_key_path)
+	}
+}
@@ -0,0 +1,53 @@
+package triton
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"triton/cloudapi"
+)
+
+// resolveDataCenter checks with CloudAPI that the datacenter exists and
+// switches to the cloudapi URL it lists for the datacenter, which for
+// private clouds may not follow the "<datacenter>.<domain>" naming.
+func (d *Driver) resolveDataCenter() error {
+	if d.DataCenter == "" {
+		return nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	datacenters, err := client.ListDatacenters(context.Background())
+	if err != nil {
+		if cloudapi.StatusCode(err) == 0 {
+			return fmt.Errorf("Unable to reach CloudAPI at %s to look up datacenter %s, check --triton-datacenter, --triton-cloudapi-domain or --triton-url: %s",
+				d.CloudApiURL, d.DataCenter, err)
+		}
+		return err
+	}
+
+	dcUrl, ok := datacenters[d.DataCenter]
+	if !ok {
+		names := make([]string, 0, len(datacenters))
+		for name := range datacenters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("Unknown datacenter %q, the datacenters of %s are: %s",
+			d.DataCenter, d.CloudApiURL, strings.Join(names, ", "))
+	}
+
+	dcUrl = strings.TrimRight(dcUrl, "/")
+	if dcUrl != strings.TrimRight(d.CloudApiURL, "/") {
+		log.Infof("Using %s, the cloudapi URL of datacenter %s", dcUrl, d.DataCenter)
+		d.CloudApiURL = dcUrl
+		d.client = nil
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package triton
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDatacentersServer serves the datacenters of a private cloud whose
+// "east" datacenter is served by the same server under another path.
+func newDatacentersServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/test/datacenters"), r.URL.Path)
+		w.Write([]byte(`{"west":"` + server.URL + `","east":"` + server.URL + `/east/"}`))
+	}))
+	return server
+}
+
+func TestResolveDataCenter(t *testing.T) {
+	server := newDatacentersServer(t)
+	defer server.Close()
+
+	d := &Driver{Account: "test", PrivateKey: "../../fixup/id_rsa", CloudApiURL: server.URL, DataCenter: "west"}
+	assert.Nil(t, d.resolveDataCenter())
+	assert.Equal(t, server.URL, d.CloudApiURL)
+
+	d.DataCenter = "east"
+	assert.Nil(t, d.resolveDataCenter())
+	assert.Equal(t, server.URL+"/east", d.CloudApiURL)
+	client, err := d.getClient()
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/east", client.URL, "Still using the client of the previous URL")
+}
+
+func TestResolveUnknownDataCenter(t *testing.T) {
+	server := newDatacentersServer(t)
+	defer server.Close()
+
+	d := &Driver{Account: "test", PrivateKey: "../../fixup/id_rsa", CloudApiURL: server.URL, DataCenter: "north"}
+	err := d.resolveDataCenter()
+	assert.NotNil(t, err, "Accepted an unknown datacenter")
+	assert.Contains(t, err.Error(), "east, west")
+}
+
+func TestResolveUnreachableDataCenter(t *testing.T) {
+	server := newDatacentersServer(t)
+	server.Close()
+
+	d := &Driver{Account: "test", PrivateKey: "../../fixup/id_rsa", CloudApiURL: server.URL, DataCenter: "west"}
+	err := d.resolveDataCenter()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "--triton-cloudapi-domain")
+}
@@ -2,17 +2,10 @@ package triton
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/json"
-	"encoding/pem"
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/big"
 	"net/http"
 	"net/url"
 	"os"
@@ -26,12 +19,15 @@ import (
 	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/crypto/ssh"
+	"triton/cloudapi"
 )
 
 const (
 	driverName                  = "triton"
 	TritonDefaultDockerPort     = 2376
 	TritonDefaultCloudapiDomain = "api.joyent.com"
+	TritonDefaultDataCenter     = "us-east-1"
 )
 
 var CreateHack = false
@@ -44,10 +40,55 @@ type Driver struct {
 	Account       string
 	PrivateKey    string
 	SkipTlsVerify bool
+	Mode          string
+	Image         string
+	Package       string
+	InstanceId    string
+
+	KeyPassphraseFile string
+	SignedHeaders     string
+	KeyIdFormat       string
+
+	Timeout int
+	Retries int
+
+	CloudApiDomain string
+
+	CaCert        string
+	CaFingerprint string
+
+	Proxy string
+
+	ClientCertExpiry  time.Time
+	CertExpiryWarning int
+
+	DockerCertFingerprint string
+
+	RegisterKey     bool
+	RegisterKeyWith string
+	RegisterKeyName string
+
+	User string
+	Role string
+
+	privateKey interface{}
+	publicKey  ssh.PublicKey
+	signer     Signer
+	client     *cloudapi.Client
+
+	warnedCertExpiry bool
+	warnedDockerCert bool
+	transports       map[string]*http.Transport
 }
 
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			Name:   "triton-profile",
+			Usage:  "triton CLI profile (from ~/.triton/profiles.d) providing the url, account, user, key and insecure settings not given with flags",
+			Value:  "",
+			EnvVar: "TRITON_PROFILE",
+		},
 		mcnflag.StringFlag{
 			Name:   "triton-url",
 			Usage:  "Triton cloudapi URL",
@@ -56,27 +97,140 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		},
 		mcnflag.StringFlag{
 			Name:   "triton-datacenter",
-			Usage:  "Triton datacenter name",
-			Value:  "us-east-1",
+			Usage:  "Triton datacenter name (defaults to '" + TritonDefaultDataCenter + "' when no cloudapi URL is given)",
+			Value:  "",
 			EnvVar: "SDC_DC",
 		},
+		mcnflag.StringFlag{
+			Name:   "triton-cloudapi-domain",
+			Usage:  "Domain of the cloudapi endpoints of the datacenters, '<datacenter>.<domain>', for private clouds",
+			Value:  TritonDefaultCloudapiDomain,
+			EnvVar: "SDC_CLOUDAPI_DOMAIN",
+		},
 		mcnflag.StringFlag{
 			Name:   "triton-account",
 			Usage:  "Triton account name",
 			Value:  "",
 			EnvVar: "SDC_ACCOUNT",
 		},
+		mcnflag.StringFlag{
+			Name:   "triton-user",
+			Usage:  "Triton RBAC sub-user of the account to authenticate as (or set TRITON_USER)",
+			Value:  "",
+			EnvVar: "SDC_USER",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-role",
+			Usage:  "Comma separated RBAC roles the sub-user assumes for CloudAPI requests",
+			Value:  "",
+			EnvVar: "SDC_ROLE",
+		},
 		mcnflag.StringFlag{
 			Name:   "triton-key",
-			Usage:  "SSH private key for Triton authentication",
+			Usage:  "SSH private key for Triton authentication, or the fingerprint of a key held by ssh-agent",
 			Value:  "",
 			EnvVar: "SDC_KEY",
 		},
+		mcnflag.BoolFlag{
+			Name:   "triton-register-key",
+			Usage:  "Add the public key of --triton-key to the account when it's missing, authenticating with --triton-register-key-with (required)",
+			EnvVar: "SDC_REGISTER_KEY",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-register-key-with",
+			Usage:  "Key already added to the account (path, name or ssh-agent fingerprint) used to add --triton-key with --triton-register-key",
+			Value:  "",
+			EnvVar: "SDC_REGISTER_KEY_WITH",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-register-key-name",
+			Usage:  "Name --triton-key is added to the account with (defaults to 'docker-machine-<machine name>')",
+			Value:  "",
+			EnvVar: "SDC_REGISTER_KEY_NAME",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-key-passphrase-file",
+			Usage:  "File holding the passphrase of an encrypted SSH private key (overrides " + KeyPassphraseEnvVar + ")",
+			Value:  "",
+			EnvVar: "SDC_KEY_PASSPHRASE_FILE",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-signed-headers",
+			Usage:  "Space separated list of headers covered by CloudAPI request signatures, e.g. 'date (request-target) host content-md5'",
+			Value:  strings.Join(DefaultSignedHeaders, " "),
+			EnvVar: "SDC_SIGNED_HEADERS",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-key-id-format",
+			Usage:  "Fingerprint form identifying the key to CloudAPI, 'md5' or 'sha256' (the other form is tried when CloudAPI rejects it)",
+			Value:  KeyIdFormatMD5,
+			EnvVar: "SDC_KEY_ID_FORMAT",
+		},
+		mcnflag.IntFlag{
+			Name:   "triton-timeout",
+			Usage:  "Seconds to wait for CloudAPI and sdc-docker to connect and respond",
+			Value:  DefaultTimeout,
+			EnvVar: "SDC_TIMEOUT",
+		},
+		mcnflag.IntFlag{
+			Name:   "triton-retries",
+			Usage:  "Number of times failed CloudAPI and sdc-docker requests are retried (0 disables retries)",
+			Value:  DefaultRetries,
+			EnvVar: "SDC_RETRIES",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-ca-cert",
+			Usage:  "PEM bundle of the CAs trusted for CloudAPI and for downloading the sdc-docker CA instead of the system ones, for private clouds",
+			Value:  "",
+			EnvVar: "SDC_CA_CERT",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-ca-fingerprint",
+			Usage:  "SHA-256 fingerprint the sdc-docker CA (ca.pem) must have, e.g. from 'openssl x509 -noout -fingerprint -sha256'",
+			Value:  "",
+			EnvVar: "SDC_CA_FINGERPRINT",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-proxy",
+			Usage:  "Proxy URL for CloudAPI and sdc-docker requests, e.g. 'http://proxy.example.com:3128' (defaults to HTTPS_PROXY, honoring NO_PROXY)",
+			Value:  "",
+			EnvVar: "SDC_PROXY",
+		},
+		mcnflag.IntFlag{
+			Name:   "triton-cert-expiry-warning",
+			Usage:  "Days before the sdc-docker client certificate expires to start warning about it",
+			Value:  DefaultCertExpiryWarning,
+			EnvVar: "SDC_CERT_EXPIRY_WARNING",
+		},
 		mcnflag.BoolFlag{
 			Name:   "triton-skip-tls-verify",
 			Usage:  "Skip tls verification 'true' or 'false' (defaults to 'false')",
 			EnvVar: "SDC_SKIP_TLS_VERIFY",
 		},
+		mcnflag.StringFlag{
+			Name:   "triton-mode",
+			Usage:  "Machine mode: 'sdc-docker' to use the datacenter docker endpoint, or 'instance' to provision a dedicated Triton instance",
+			Value:  ModeSdcDocker,
+			EnvVar: "SDC_MODE",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-image",
+			Usage:  "Triton image name or UUID for the instance (instance mode only)",
+			Value:  "",
+			EnvVar: "SDC_IMAGE",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-package",
+			Usage:  "Triton package name or UUID for the instance (instance mode only)",
+			Value:  "",
+			EnvVar: "SDC_PACKAGE",
+		},
+		mcnflag.StringFlag{
+			Name:   "triton-ssh-user",
+			Usage:  "SSH user used to provision the instance (instance mode only)",
+			Value:  TritonDefaultSSHUser,
+			EnvVar: "SDC_SSH_USER",
+		},
 	}
 }
 
@@ -100,10 +254,18 @@ func NewDriver(machineName string, storePath string) Driver {
 
 // Create a host using the driver's config
 func (d *Driver) Create() error {
+	if d.IsInstance() {
+		// Leave the driver name alone so docker-machine installs and
+		// configures docker on the new instance over SSH.
+		return d.createInstance()
+	}
+
 	CreateHack = true
 
-	log.Infof("Generating %s user certificates - you will be prompted for", driverName)
-	log.Infof("your SSH private key password (if it's password protected).")
+	// docker-machine runs the driver without a terminal to ask for the
+	// passphrase of an encrypted key on.
+	log.Infof("Generating %s user certificates - encrypted SSH keys need", driverName)
+	log.Infof("--triton-key-passphrase-file or %s.", KeyPassphraseEnvVar)
 
 	err := d.RegisterWithSdcCloudApi()
 	if err != nil {
@@ -143,6 +305,13 @@ func (d *Driver) DriverName() string {
 // GetIP returns an IP or hostname that this host is available at
 // e.g. 1.2.3.4 or docker-host-d60b70a14d3a.cloudapp.net
 func (d *Driver) GetIP() (string, error) {
+	if d.IsInstance() {
+		if d.IPAddress == "" {
+			return "", fmt.Errorf("Instance %s has no IP address", d.InstanceId)
+		}
+		return d.IPAddress, nil
+	}
+
 	// DockerApiURL looks like: 'tcp://foo.bar:2376'
 	u, err := url.Parse(d.DockerApiURL)
 	if err != nil {
@@ -158,6 +327,9 @@ func (d *Driver) GetMachineName() string {
 
 // GetSSHHostname returns hostname for use with ssh
 func (d *Driver) GetSSHHostname() (string, error) {
+	if d.IsInstance() {
+		return d.GetIP()
+	}
 	return "", fmt.Errorf("SSH is not available for the triton driver")
 }
 
@@ -168,35 +340,65 @@ func (d *Driver) GetSSHPort() (int, error) {
 
 // GetSSHUsername returns username for use with ssh
 func (d *Driver) GetSSHUsername() string {
+	if d.IsInstance() {
+		return d.SSHUser
+	}
 	return d.Account
 }
 
 // GetSSHKeyPath returns key path for use with ssh
 func (d *Driver) GetSSHKeyPath() string {
+	if d.UsesAgent() {
+		return ""
+	}
 	return d.PrivateKey
 }
 
 // GetURL returns a Docker compatible host URL for connecting to this host
 // e.g. tcp://1.2.3.4:2376
 func (d *Driver) GetURL() (string, error) {
+	if d.IsInstance() {
+		ip, err := d.GetIP()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tcp://%s:%d", ip, TritonDefaultDockerPort), nil
+	}
+	d.warnCertExpiry()
 	return d.DockerApiURL, nil
 }
 
 // GetState returns the state that the host is in (running, stopped, etc)
 func (d *Driver) GetState() (state.State, error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	if d.IsInstance() {
+		return d.getInstanceState()
+	}
+
+	d.warnCertExpiry()
+
+	transport, err := d.dockerTransport()
+	if err != nil {
+		return state.Error, err
 	}
+	client := d.httpClient(transport)
 	u := d.GetHttpsURL()
 
 	resp, err := client.Get(fmt.Sprintf("%s/_ping", u))
+	if isUnknownAuthority(err) {
+		return state.Error, d.explainCertificateError(err)
+	}
 	if err != nil {
-		return state.Error, nil
+		return state.Error, err
 	}
 	defer resp.Body.Close()
+	err = d.checkDockerCertificate(resp.TLS)
+	if err != nil {
+		return state.Error, err
+	}
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return state.Error, err
+	}
 
 	if string(body[:]) == "OK" {
 		return state.Running, nil
@@ -204,24 +406,33 @@ func (d *Driver) GetState() (state.State, error) {
 	return state.None, nil
 }
 
-// Kill stops a host forcefully
+// Kill stops a host forcefully. CloudAPI has no forced stop, so for
+// instances this is the same as Stop.
 func (d *Driver) Kill() error {
+	if d.IsInstance() {
+		return d.machineAction("stop", "stopped")
+	}
 	return fmt.Errorf("Kill is not available for the triton driver")
 }
 
-// PreCreateCheck allows for pre-create operations to make sure a driver is ready for creation
-func (d *Driver) PreCreateCheck() error {
-	return nil
-}
-
 // Remove a host
 func (d *Driver) Remove() error {
-	return nil
+	if d.IsInstance() {
+		err := d.removeInstance()
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.RemoveCertificates()
 }
 
 // Restart a host. This may just call Stop(); Start() if the provider does not
 // have any special restart behaviour.
 func (d *Driver) Restart() error {
+	if d.IsInstance() {
+		return d.machineAction("reboot", "running")
+	}
 	return fmt.Errorf("Restart is not available for the triton driver")
 }
 
@@ -230,51 +441,181 @@ func (d *Driver) Restart() error {
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.CloudApiURL = flags.String("triton-url")
 	d.Account = flags.String("triton-account")
+	d.User = flags.String("triton-user")
+	d.Role = flags.String("triton-role")
 	d.DataCenter = flags.String("triton-datacenter")
+	d.CloudApiDomain = flags.String("triton-cloudapi-domain")
 	d.PrivateKey = flags.String("triton-key")
+	d.KeyPassphraseFile = flags.String("triton-key-passphrase-file")
+	d.RegisterKey = flags.Bool("triton-register-key")
+	d.RegisterKeyWith = flags.String("triton-register-key-with")
+	d.RegisterKeyName = flags.String("triton-register-key-name")
+	d.SignedHeaders = flags.String("triton-signed-headers")
+	d.KeyIdFormat = flags.String("triton-key-id-format")
+	d.Timeout = flags.Int("triton-timeout")
+	d.Retries = flags.Int("triton-retries")
+	d.CaCert = flags.String("triton-ca-cert")
+	d.CaFingerprint = flags.String("triton-ca-fingerprint")
+	d.CertExpiryWarning = flags.Int("triton-cert-expiry-warning")
+	d.Proxy = flags.String("triton-proxy")
 	d.SkipTlsVerify = flags.Bool("triton-skip-tls-verify")
+	d.Mode = flags.String("triton-mode")
+	d.Image = flags.String("triton-image")
+	d.Package = flags.String("triton-package")
+	d.SSHUser = flags.String("triton-ssh-user")
+
+	homedir := mcnutils.GetHomeDir()
+	if homedir != "" {
+		err := d.applyTritonProfile(flags.String("triton-profile"), tritonConfigDir(homedir))
+		if err != nil {
+			return err
+		}
+	}
 
+	if d.CloudApiDomain == "" {
+		d.CloudApiDomain = TritonDefaultCloudapiDomain
+	}
 	if d.CloudApiURL == "" {
 		if d.DataCenter == "" {
-			return fmt.Errorf("You must specify a cloudapi url or datacenter name")
+			d.DataCenter = TritonDefaultDataCenter
 		}
-		// Shortend format for the cloudapi name, e.g. "us-east-1"
-		d.CloudApiURL = fmt.Sprintf("https://%s.%s", d.DataCenter, TritonDefaultCloudapiDomain)
+		// Shortend format for the cloudapi name, e.g. "us-east-1". The
+		// datacenter is validated by PreCreateCheck.
+		d.CloudApiURL = fmt.Sprintf("https://%s.%s", d.DataCenter, d.CloudApiDomain)
 	}
 
 	if d.Account == "" {
 		return fmt.Errorf("You must specify the account name using --triton-account")
 	}
 
+	if d.User == "" {
+		d.User = os.Getenv("TRITON_USER")
+	}
+	if d.Role != "" && d.User == "" {
+		return fmt.Errorf("--triton-role can only be used by a sub-user, specify it using --triton-user")
+	}
+
 	if d.PrivateKey == "" {
-		homedir := mcnutils.GetHomeDir()
 		if homedir == "" {
 			return fmt.Errorf("You must specify the SSH key using --triton-key")
 		}
 		d.PrivateKey = path.Join(homedir, ".ssh", "id_rsa")
 	}
 
-	_, err := os.Stat(d.PrivateKey)
+	switch d.Mode {
+	case "":
+		d.Mode = ModeSdcDocker
+	case ModeSdcDocker:
+	case ModeInstance:
+		if d.Image == "" {
+			return fmt.Errorf("You must specify the instance image using --triton-image")
+		}
+		if d.Package == "" {
+			return fmt.Errorf("You must specify the instance package using --triton-package")
+		}
+		if d.SSHUser == "" {
+			d.SSHUser = TritonDefaultSSHUser
+		}
+	default:
+		return fmt.Errorf("Unknown --triton-mode %q, expected %q or %q", d.Mode, ModeSdcDocker, ModeInstance)
+	}
+
+	if d.Timeout < 0 {
+		return fmt.Errorf("--triton-timeout must not be negative")
+	}
+	if d.Retries < 0 {
+		return fmt.Errorf("--triton-retries must not be negative")
+	}
+	if d.CertExpiryWarning < 0 {
+		return fmt.Errorf("--triton-cert-expiry-warning must not be negative")
+	}
+
+	switch d.KeyIdFormat {
+	case "":
+		d.KeyIdFormat = KeyIdFormatMD5
+	case KeyIdFormatMD5, KeyIdFormatSHA256:
+	default:
+		return fmt.Errorf("Unknown --triton-key-id-format %q, expected %q or %q", d.KeyIdFormat, KeyIdFormatMD5, KeyIdFormatSHA256)
+	}
+
+	if d.CaCert != "" {
+		_, err := loadCertPool(d.CaCert)
+		if err != nil {
+			return fmt.Errorf("Unable to load --triton-ca-cert: %s", err)
+		}
+	}
+	if d.CaFingerprint != "" {
+		fingerprint, err := normalizeCaFingerprint(d.CaFingerprint)
+		if err != nil {
+			return fmt.Errorf("Invalid --triton-ca-fingerprint: %s", err)
+		}
+		d.CaFingerprint = fingerprint
+	}
+
+	if d.Proxy != "" {
+		_, err := parseProxy(d.Proxy)
+		if err != nil {
+			return fmt.Errorf("Invalid --triton-proxy: %s", err)
+		}
+	}
+
+	var sshDir string
+	if homedir != "" {
+		sshDir = path.Join(homedir, ".ssh")
+	}
+	privateKey, err := resolveKey(d.PrivateKey, sshDir)
 	if err != nil {
-		return fmt.Errorf("Unable to access SSH key file %s", d.PrivateKey)
+		return err
+	}
+	d.PrivateKey = privateKey
+
+	if d.RegisterKey && d.RegisterKeyWith == "" {
+		return fmt.Errorf("--triton-register-key needs a key that was already added to the account, specify it using --triton-register-key-with")
+	}
+	if d.RegisterKeyWith != "" {
+		d.RegisterKeyWith, err = resolveKey(d.RegisterKeyWith, sshDir)
+		if err != nil {
+			return err
+		}
 	}
 
 	log.Debugf("CloudApiURL: %s", d.CloudApiURL)
 	log.Debugf("Account: %s", d.Account)
+	log.Debugf("User: %s", d.User)
+	log.Debugf("Role: %s", d.Role)
 	log.Debugf("DataCenter: %s", d.DataCenter)
+	log.Debugf("CloudApiDomain: %s", d.CloudApiDomain)
 	log.Debugf("PrivateKey: %s", d.PrivateKey)
+	log.Debugf("KeyIdFormat: %s", d.KeyIdFormat)
+	log.Debugf("RegisterKey: %t", d.RegisterKey)
+	log.Debugf("RegisterKeyWith: %s", d.RegisterKeyWith)
+	log.Debugf("Timeout: %d", d.Timeout)
+	log.Debugf("Retries: %d", d.Retries)
+	log.Debugf("CaCert: %s", d.CaCert)
+	log.Debugf("CaFingerprint: %s", d.CaFingerprint)
+	log.Debugf("Proxy: %s", d.Proxy)
+	log.Debugf("CertExpiryWarning: %d", d.CertExpiryWarning)
 	log.Debugf("SkipTlsVerify: %d", d.SkipTlsVerify)
+	log.Debugf("Mode: %s", d.Mode)
+	log.Debugf("Image: %s", d.Image)
+	log.Debugf("Package: %s", d.Package)
 
 	return nil
 }
 
 // Start a host
 func (d *Driver) Start() error {
+	if d.IsInstance() {
+		return d.machineAction("start", "running")
+	}
 	return fmt.Errorf("Start is not available for the triton driver")
 }
 
 // Stop a host gracefully
 func (d *Driver) Stop() error {
+	if d.IsInstance() {
+		return d.machineAction("stop", "stopped")
+	}
 	return fmt.Errorf("Stop is not available for the triton driver")
 }
 
@@ -289,37 +630,27 @@ func (d *Driver) GetHttpsURL() string {
 }
 
 /*
- * Download the certificate authority file from the sdc-docker server.
+ * Download the certificate authority file from the sdc-docker server,
+ * verifying it against --triton-ca-fingerprint when given.
  */
 func (d *Driver) DownloadCa() error {
-	dockerHttpsUrl := d.GetHttpsURL()
-	caUrl := fmt.Sprintf("%s/ca.pem", dockerHttpsUrl)
-	log.Debugf("Downloading ca.pem file from %s", caUrl)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: d.SkipTlsVerify},
-		},
-	}
-	resp, err := client.Get(caUrl)
+	data, err := d.fetchCa()
 	if err != nil {
-		log.Debugf("Unable to open http request to url: %s", caUrl)
 		return err
 	}
-	defer resp.Body.Close()
 
-	caFile := d.ResolveStorePath("ca.pem")
-	log.Debugf("CA: %s", caFile)
-	out, err := os.Create(caFile)
+	fingerprints, err := caFingerprints(data)
+	if err != nil {
+		return fmt.Errorf("Invalid ca.pem from %s: %s", d.DockerApiURL, err)
+	}
+	err = d.checkCaFingerprint(fingerprints)
 	if err != nil {
-		log.Debugf("Unable to create ca.pm: %s", caFile)
 		return err
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
 
-	return err
+	caFile := d.ResolveStorePath("ca.pem")
+	log.Debugf("CA: %s", caFile)
+	return ioutil.WriteFile(caFile, data, 0644)
 }
 
 func RunCommand(cmd []string, stdin string) (string, string, error) {
@@ -371,61 +702,43 @@ func RunCommand(cmd []string, stdin string) (string, string, error) {
 	return stdout, stderr, err
 }
 
-func (d *Driver) MakeCloudApiRequest(now string, encDateString string, sshKeyId string) error {
-	//response=$(curl $CURL_OPTS $curlOpts -isS \
-	//    -H "Accept:application/json" -H "api-version:*" -H "Date: ${now}" \
-	//    -H "Authorization: Signature keyId=\"/$account/keys/$sshKeyId\",algorithm=\"rsa-sha256\" ${signature}" \
-	//    --url $cloudapiUrl/$account/services)
-	cloudapiUrl := fmt.Sprintf("%s/%s/services", d.CloudApiURL, d.Account)
-	log.Debugf("CloudAPI url: ", cloudapiUrl)
+// login returns the account, or "<account>/<user>" for a sub-user. It is
+// also the CN of the client certificate, which sdc-docker maps to the
+// account.
+func (d *Driver) login() string {
+	if d.User != "" {
+		return d.Account + "/" + d.User
+	}
+	return d.Account
+}
 
-	req, err := http.NewRequest("GET", cloudapiUrl, nil)
+// MakeCloudApiRequest looks up the account's services in CloudAPI, which
+// registers the key with sdc-docker, and records the docker endpoint.
+func (d *Driver) MakeCloudApiRequest() error {
+	client, err := d.getClient()
 	if err != nil {
-		log.Debugf("http.NewRequest failed for url %s", cloudapiUrl)
 		return err
 	}
-
-	sig := fmt.Sprintf("Signature keyId=\"/%s/keys/%s\",algorithm=\"rsa-sha256\" %s",
-		d.Account, sshKeyId, encDateString)
-	req.Header.Add("Authorization", sig)
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("api-version", "*")
-	req.Header.Add("Date", now)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: d.SkipTlsVerify},
-		},
+	services, err := client.ListServices(context.Background())
+	status := cloudapi.StatusCode(err)
+	if d.RegisterKey && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+		log.Infof("CloudAPI didn't accept the key %s, checking it was added to %s", d.PrivateKey, d.login())
+		err = d.registerKey()
+		if err != nil {
+			return err
+		}
+		services, err = client.ListServices(context.Background())
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Debugf("client.Do failed for url %s", cloudapiUrl)
-		return err
+	if cloudapi.StatusCode(err) == http.StatusForbidden { // 403
+		return fmt.Errorf("ERROR: CloudAPI registration was forbidden: %s", err.(*cloudapi.Error).Message)
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Debugf("resp.Body.read failed for url %s", cloudapiUrl)
 		return err
 	}
 
-	log.Debugf("CloudAPI response: %s", body)
-
-	var respMap map[string]interface{}
-	json.Unmarshal([]byte(body), &respMap)
-
-	if resp.StatusCode == http.StatusForbidden { // 403
-		return fmt.Errorf("ERROR: CloudAPI registration was forbidden: %s", respMap["message"])
-	}
-
-	if resp.StatusCode != http.StatusOK { // 200
-		return fmt.Errorf("ERROR: CloudAPI registration failed: %s", respMap["message"])
-	}
-
-	dockerUrl, ok := respMap["docker"].(string)
+	dockerUrl, ok := services["docker"]
 	if !ok {
-		return fmt.Errorf("Could not convert docker response url to string, respMap %s", respMap)
+		return fmt.Errorf("CloudAPI doesn't offer a docker service in %s, services %v", d.CloudApiURL, services)
 	}
 
 	// Sanity check the url.
@@ -442,24 +755,8 @@ func (d *Driver) MakeCloudApiRequest(now string, encDateString string, sshKeyId
 func (d *Driver) RegisterWithSdcCloudApi() error {
 	log.Debugf("registering with sdc cloud api")
 
-	// now=$(date -u "+%a, %d %h %Y %H:%M:%S GMT")
-	now := time.Now().UTC().Format(time.RFC1123)
-
-	signer, err := LoadPrivateKey(d.PrivateKey, "")
-	if err != nil {
-		log.Debugf("error loading the private key! %+v\n", err)
-		return err
-	}
-	encDateString, err := signer.SignToString([]byte(now))
-
-	sshKeyId, err := GetSshKeyId(d.PrivateKey + ".pub")
-	if err != nil {
-		log.Debugf("Error in getting key fingerprint, %+v\n", err)
-		return err
-	}
-
 	// Register this user/key with the SDC cloud API.
-	err = d.MakeCloudApiRequest(now, encDateString, sshKeyId)
+	err := d.MakeCloudApiRequest()
 	if err != nil {
 		log.Debugf("MakeCloudApiRequest failed %s", err)
 		return err
@@ -469,92 +766,70 @@ func (d *Driver) RegisterWithSdcCloudApi() error {
 }
 
 /*
- * Generate the client certificates (from the users private SSH key).
- *
- * This also generates the server*.pem certificate files, but these are
- * not used by sdc-docker (it just keeps docker-machine happy).
+ * Remove the certificate and key files written by GenerateCertificates and
+ * DownloadCa. Files holding private key material are overwritten before
+ * they are unlinked.
  */
-func (d *Driver) GenerateCertificates() error {
-	err := d.DownloadCa()
-	if err != nil {
-		return err
+func (d *Driver) RemoveCertificates() error {
+	for _, name := range []string{"key.pem", "server-key.pem", "cert.csr", "cert.pem", "server.pem", "ca.pem"} {
+		err := secureRemove(d.ResolveStorePath(name))
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	var keyFile = d.ResolveStorePath("key.pem")
-	var csrFile = d.ResolveStorePath("cert.csr")
-	var certFile = d.ResolveStorePath("cert.pem")
-
-	cmd := exec.Command("openssl", "rsa", "-in", d.PrivateKey, "-outform", "pem", "-out", keyFile)
-	err = cmd.Run()
-	if err != nil {
-		return err
+// secureRemove overwrites a file with zeros before removing it. Missing
+// files are ignored.
+func secureRemove(file string) error {
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil
 	}
-
-	cmd = exec.Command("openssl", "req", "-new", "-key", keyFile, "-out", csrFile, "-subj", "/CN="+d.Account)
-	err = cmd.Run()
 	if err != nil {
 		return err
 	}
 
-	cmd = exec.Command("openssl", "x509", "-req", "-days", "365", "-in", csrFile, "-signkey", keyFile, "-out", certFile)
-	err = cmd.Run()
+	log.Debugf("Removing %s", file)
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
 	if err != nil {
 		return err
 	}
-
-	log.Debugf("Generating server certificates")
-
-	pemBytes, _ := ioutil.ReadFile(keyFile)
-	block, _ := pem.Decode(pemBytes)
-	if block == nil {
-		return errors.New("ssh: no key found")
+	_, err = f.Write(make([]byte, info.Size()))
+	if err == nil {
+		err = f.Sync()
 	}
-
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	f.Close()
 	if err != nil {
 		return err
 	}
 
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(123),
-		Subject: pkix.Name{
-			CommonName: d.Account,
-		},
-		SignatureAlgorithm:    x509.SHA512WithRSA,
-		PublicKeyAlgorithm:    x509.RSA,
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		SubjectKeyId:          []byte{1, 2, 3, 4, 5},
-		BasicConstraintsValid: true,
-		IsCA:        false,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
-	}
-
-	ca_b, err := x509.CreateCertificate(rand.Reader, ca, ca, &key.PublicKey, key)
+	return os.Remove(file)
+}
+
+/*
+ * Generate the client certificates (from the users private SSH key).
+ *
+ * This also generates the server*.pem certificate files, but these are
+ * not used by sdc-docker (it just keeps docker-machine happy). They get a
+ * throwaway key of their own so the SSH key isn't copied any further.
+ */
+func (d *Driver) GenerateCertificates() error {
+	err := d.DownloadCa()
 	if err != nil {
 		return err
 	}
 
-	log.Debugf("writing server certificates")
-
-	var serverKeyFile = d.ResolveStorePath("server-key.pem")
-	var serverCertFile = d.ResolveStorePath("server.pem")
-
-	certOut, _ := os.OpenFile(serverCertFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	err = d.verifyDockerEndpoint()
 	if err != nil {
 		return err
 	}
-	defer certOut.Close()
 
-	keyOut, _ := os.OpenFile(serverKeyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	err = d.generateClientCertificate()
 	if err != nil {
 		return err
 	}
-	defer keyOut.Close()
-
-	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: ca_b})
-	pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
 
-	return nil
+	return d.generateServerCertificate()
 }
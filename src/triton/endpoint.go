@@ -0,0 +1,64 @@
+package triton
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// verifyDockerEndpoint connects to the sdc-docker endpoint, verifies its
+// certificate chains to the downloaded ca.pem and matches its hostname,
+// as the docker client will, and records the certificate fingerprint.
+func (d *Driver) verifyDockerEndpoint() error {
+	transport, err := d.dockerTransport()
+	if err != nil {
+		return err
+	}
+
+	pingUrl := fmt.Sprintf("%s/_ping", d.GetHttpsURL())
+	log.Debugf("Verifying the certificate of %s", d.DockerApiURL)
+	resp, err := d.httpClient(transport).Get(pingUrl)
+	if isUnknownAuthority(err) {
+		return fmt.Errorf("The certificate of %s isn't signed by the sdc-docker CA it served (ca.pem), the docker client wouldn't trust it: %s",
+			d.DockerApiURL, err)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to verify the certificate of %s: %s", d.DockerApiURL, err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return fmt.Errorf("%s didn't serve a TLS certificate", d.DockerApiURL)
+	}
+
+	d.DockerCertFingerprint = CertFingerprint(resp.TLS.PeerCertificates[0])
+	log.Debugf("The certificate of %s has the SHA-256 fingerprint %s", d.DockerApiURL, d.DockerCertFingerprint)
+
+	return nil
+}
+
+// checkDockerCertificate compares the certificate the sdc-docker endpoint
+// served with the one recorded when the machine was created. A verified
+// certificate that changed is most likely a renewal and only warned about,
+// without verification it is the only sign of a man in the middle.
+func (d *Driver) checkDockerCertificate(state *tls.ConnectionState) error {
+	if d.DockerCertFingerprint == "" || state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	fingerprint := CertFingerprint(state.PeerCertificates[0])
+	if fingerprint == d.DockerCertFingerprint {
+		return nil
+	}
+
+	if d.SkipTlsVerify {
+		return fmt.Errorf("The certificate of %s changed from %s to %s and isn't verified (--triton-skip-tls-verify), recreate the machine if the change is expected",
+			d.DockerApiURL, d.DockerCertFingerprint, fingerprint)
+	}
+	if !d.warnedDockerCert {
+		log.Warnf("The certificate of %s changed from %s to %s, it is still signed by ca.pem; run 'docker-machine-driver-triton regenerate-certs %s' to record it",
+			d.DockerApiURL, d.DockerCertFingerprint, fingerprint, d.MachineName)
+		d.warnedDockerCert = true
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package triton
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultSignedHeaders are the headers covered by request signatures
+// unless configured otherwise. Signing the request line means a captured
+// Authorization header can't be replayed against another resource.
+var DefaultSignedHeaders = []string{"date", "(request-target)"}
+
+// SignatureParams are the parameters of an http-signature Authorization
+// header, see https://github.com/joyent/node-http-signature.
+type SignatureParams struct {
+	KeyId     string
+	Algorithm string
+	// Headers lists the (lowercase) headers covered by the signature. It
+	// is empty for the legacy CloudAPI form, which signs the bare value of
+	// the Date header.
+	Headers   []string
+	Signature string
+}
+
+// ParseAuthorizationHeader parses an http-signature Authorization header.
+// Both the standard form (with a signature="..." parameter) and the legacy
+// CloudAPI form (with the signature following the parameters) are
+// accepted.
+func ParseAuthorizationHeader(header string) (*SignatureParams, error) {
+	const scheme = "Signature "
+	if !strings.HasPrefix(header, scheme) {
+		return nil, errors.New("http-signature: not a Signature authorization header")
+	}
+
+	params := &SignatureParams{}
+	rest := strings.TrimSpace(header[len(scheme):])
+	for rest != "" {
+		eq := strings.Index(rest, "=\"")
+		if eq < 0 {
+			// Legacy form, the remainder is the signature itself.
+			if params.Signature != "" {
+				return nil, fmt.Errorf("http-signature: unexpected %q", rest)
+			}
+			params.Signature = rest
+			break
+		}
+
+		name := strings.TrimSpace(rest[:eq])
+		end := strings.Index(rest[eq+2:], "\"")
+		if end < 0 {
+			return nil, fmt.Errorf("http-signature: unterminated value for %s", name)
+		}
+		value := rest[eq+2 : eq+2+end]
+		rest = strings.TrimLeft(rest[eq+2+end+1:], ", ")
+
+		switch name {
+		case "keyId":
+			params.KeyId = value
+		case "algorithm":
+			params.Algorithm = strings.ToLower(value)
+		case "headers":
+			params.Headers = strings.Fields(strings.ToLower(value))
+		case "signature":
+			params.Signature = value
+		default:
+			return nil, fmt.Errorf("http-signature: unknown parameter %q", name)
+		}
+	}
+
+	if params.KeyId == "" {
+		return nil, errors.New("http-signature: missing keyId")
+	}
+	if params.Algorithm == "" {
+		return nil, errors.New("http-signature: missing algorithm")
+	}
+	if params.Signature == "" {
+		return nil, errors.New("http-signature: missing signature")
+	}
+
+	return params, nil
+}
+
+// SigningString returns the string covered by a signature over the given
+// headers of the request.
+func SigningString(req *http.Request, headers []string) (string, error) {
+	if len(headers) == 0 {
+		date := req.Header.Get("Date")
+		if date == "" {
+			return "", errors.New("http-signature: missing Date header")
+		}
+		return date, nil
+	}
+
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		h = strings.ToLower(h)
+		var value string
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		default:
+			value = req.Header.Get(h)
+		}
+		if value == "" {
+			return "", fmt.Errorf("http-signature: missing %s header", h)
+		}
+		lines = append(lines, h+": "+value)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// VerifyRequest checks the http-signature Authorization header of req
+// against the public key of verifier.
+func VerifyRequest(req *http.Request, verifier Verifier) error {
+	params, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
+	if err != nil {
+		return err
+	}
+
+	return VerifySignature(req, params, verifier)
+}
+
+// VerifySignature checks already parsed signature parameters of req
+// against the public key of verifier.
+func VerifySignature(req *http.Request, params *SignatureParams, verifier Verifier) error {
+	if params.Algorithm != verifier.Algorithm() {
+		return fmt.Errorf("http-signature: algorithm %q doesn't match the %q key", params.Algorithm, verifier.Algorithm())
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(params.Signature)
+	if err != nil {
+		return fmt.Errorf("http-signature: invalid signature encoding: %s", err)
+	}
+
+	signingString, err := SigningString(req, params.Headers)
+	if err != nil {
+		return err
+	}
+
+	err = verifier.Verify([]byte(signingString), sig)
+	if err != nil {
+		return fmt.Errorf("http-signature: invalid signature: %s", err)
+	}
+
+	return nil
+}
+
+// RequestSigner signs HTTP requests with the http-signature scheme.
+type RequestSigner struct {
+	// KeyId identifies the key to the server, e.g. "/account/keys/<fp>".
+	KeyId  string
+	Signer Signer
+	// Headers to sign, DefaultSignedHeaders when empty. Besides regular
+	// headers "(request-target)" and "host" may be used.
+	Headers []string
+}
+
+// SignRequest adds the Authorization header (and the Date and Content-MD5
+// headers when they are signed but missing) to req.
+func (s *RequestSigner) SignRequest(req *http.Request) error {
+	headers := s.Headers
+	if len(headers) == 0 {
+		headers = DefaultSignedHeaders
+	}
+
+	for _, h := range headers {
+		switch strings.ToLower(h) {
+		case "date":
+			if req.Header.Get("Date") == "" {
+				req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+			}
+		case "content-md5":
+			if req.Header.Get("Content-MD5") == "" {
+				sum, err := contentMD5(req)
+				if err != nil {
+					return err
+				}
+				req.Header.Set("Content-MD5", sum)
+			}
+		}
+	}
+
+	signingString, err := SigningString(req, headers)
+	if err != nil {
+		return err
+	}
+	sig, err := s.Signer.SignToString([]byte(signingString))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Signature keyId=\"%s\",algorithm=\"%s\",headers=\"%s\",signature=\"%s\"",
+		s.KeyId, s.Signer.Algorithm(), strings.ToLower(strings.Join(headers, " ")), sig))
+
+	return nil
+}
+
+// contentMD5 returns the base64 encoded MD5 digest of the request body,
+// leaving the body readable.
+func contentMD5(req *http.Request) (string, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	sum := md5.Sum(body)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// SigningTransport is an http.RoundTripper signing every request with
+// Signer before handing it to Base (http.DefaultTransport when nil).
+type SigningTransport struct {
+	Signer *RequestSigner
+	Base   http.RoundTripper
+}
+
+func (t *SigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the caller's request.
+	signed := new(http.Request)
+	*signed = *req
+	signed.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		signed.Header[k] = append([]string(nil), v...)
+	}
+
+	err := t.Signer.SignRequest(signed)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
@@ -0,0 +1,166 @@
+package triton
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthorizationHeader(t *testing.T) {
+	params, err := ParseAuthorizationHeader(`Signature keyId="/test/keys/aa:bb",algorithm="rsa-sha256",headers="date (request-target)",signature="c2lnbmF0dXJl"`)
+
+	assert.Nil(t, err, "Can't parse header")
+	assert.Equal(t, "/test/keys/aa:bb", params.KeyId)
+	assert.Equal(t, "rsa-sha256", params.Algorithm)
+	assert.Equal(t, []string{"date", "(request-target)"}, params.Headers)
+	assert.Equal(t, "c2lnbmF0dXJl", params.Signature)
+}
+
+func TestParseLegacyAuthorizationHeader(t *testing.T) {
+	params, err := ParseAuthorizationHeader(`Signature keyId="/test/keys/aa:bb",algorithm="rsa-sha256" c2lnbmF0dXJlcw==`)
+
+	assert.Nil(t, err, "Can't parse header")
+	assert.Equal(t, "/test/keys/aa:bb", params.KeyId)
+	assert.Equal(t, "rsa-sha256", params.Algorithm)
+	assert.Equal(t, 0, len(params.Headers))
+	assert.Equal(t, "c2lnbmF0dXJlcw==", params.Signature)
+}
+
+func TestParseInvalidAuthorizationHeader(t *testing.T) {
+	for _, header := range []string{
+		"",
+		`Basic dGVzdDp0ZXN0`,
+		`Signature keyId="/test/keys/aa:bb",algorithm="rsa-sha256"`,
+		`Signature algorithm="rsa-sha256",signature="c2lnbmF0dXJl"`,
+		`Signature keyId="/test/keys/aa:bb,algorithm=rsa-sha256`,
+	} {
+		_, err := ParseAuthorizationHeader(header)
+
+		assert.NotNil(t, err, header)
+	}
+}
+
+func newSignedRequest(t *testing.T, ssh_private_key_path string) *http.Request {
+	req, err := http.NewRequest("GET", "https://cloudapi.test/test/services", nil)
+	assert.Nil(t, err)
+
+	d := &Driver{Account: "test", PrivateKey: ssh_private_key_path}
+	err = d.signRequest(req)
+	assert.Nil(t, err, "Can't sign request")
+
+	return req
+}
+
+func TestVerifyRequest(t *testing.T) {
+	for _, ssh_private_key_path := range []string{
+		"../../fixup/id_rsa",
+		"../../fixup/id_ecdsa",
+		"../../fixup/id_ed25519",
+	} {
+		req := newSignedRequest(t, ssh_private_key_path)
+
+		verifier, err := LoadPublicKey(ssh_private_key_path + ".pub")
+		assert.Nil(t, err, "Can't load public key")
+
+		assert.Nil(t, VerifyRequest(req, verifier), ssh_private_key_path)
+	}
+}
+
+func TestSignedRequestAlgorithm(t *testing.T) {
+	// CloudAPI rejects algorithms that aren't of the form <key>-<hash>.
+	for ssh_private_key_path, algorithm := range map[string]string{
+		"../../fixup/id_rsa":     "rsa-sha256",
+		"../../fixup/id_ecdsa":   "ecdsa-sha256",
+		"../../fixup/id_ed25519": "ed25519-sha512",
+	} {
+		req := newSignedRequest(t, ssh_private_key_path)
+
+		assert.Contains(t, req.Header.Get("Authorization"), `,algorithm="`+algorithm+`",`, ssh_private_key_path)
+	}
+}
+
+func TestVerifyRequestWithTamperedDate(t *testing.T) {
+	req := newSignedRequest(t, "../../fixup/id_rsa")
+	req.Header.Set("Date", "Mon, 15 Feb 2016 18:18:13 GMT")
+
+	verifier, err := LoadPublicKey("../../fixup/id_rsa.pub")
+	assert.Nil(t, err, "Can't load public key")
+
+	assert.NotNil(t, VerifyRequest(req, verifier), "Accepted a tampered request")
+}
+
+func TestVerifyRequestWithWrongKey(t *testing.T) {
+	req := newSignedRequest(t, "../../fixup/id_rsa")
+
+	verifier, err := LoadPublicKey("../../fixup/pass_id_rsa.pub")
+	assert.Nil(t, err, "Can't load public key")
+
+	assert.NotNil(t, VerifyRequest(req, verifier), "Accepted a signature from another key")
+}
+
+func newRequestSigner(t *testing.T, headers []string) *RequestSigner {
+	signer, err := LoadPrivateKey("../../fixup/id_rsa", "")
+	assert.Nil(t, err, "Can't load private key")
+
+	return &RequestSigner{KeyId: "/test/keys/22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", Signer: signer, Headers: headers}
+}
+
+func TestRequestSignerHeaders(t *testing.T) {
+	req, err := http.NewRequest("POST", "https://cloudapi.test/test/machines?action=start", strings.NewReader(`{"name":"test"}`))
+	assert.Nil(t, err)
+
+	requestSigner := newRequestSigner(t, []string{"date", "(request-target)", "host", "content-md5"})
+	assert.Nil(t, requestSigner.SignRequest(req), "Can't sign request")
+
+	assert.Equal(t, "K4lbbvqii4GChOXGlqGHmQ==", req.Header.Get("Content-MD5"))
+
+	params, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
+	assert.Nil(t, err, "Can't parse header")
+	assert.Equal(t, []string{"date", "(request-target)", "host", "content-md5"}, params.Headers)
+
+	signingString, err := SigningString(req, params.Headers)
+	assert.Nil(t, err)
+	assert.Equal(t, "date: "+req.Header.Get("Date")+"\n"+
+		"(request-target): post /test/machines?action=start\n"+
+		"host: cloudapi.test\n"+
+		"content-md5: K4lbbvqii4GChOXGlqGHmQ==", signingString)
+
+	verifier, err := LoadPublicKey("../../fixup/id_rsa.pub")
+	assert.Nil(t, err, "Can't load public key")
+	assert.Nil(t, VerifyRequest(req, verifier))
+
+	// The signature must not be usable for another resource.
+	req.URL.Path = "/test/machines/other"
+	assert.NotNil(t, VerifyRequest(req, verifier), "Accepted a replayed signature")
+}
+
+func TestSigningTransport(t *testing.T) {
+	verifier, err := LoadPublicKey("../../fixup/id_rsa.pub")
+	assert.Nil(t, err, "Can't load public key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyRequest(r, verifier); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &SigningTransport{Signer: newRequestSigner(t, []string{"date", "(request-target)", "host"})},
+	}
+
+	req, err := http.NewRequest("GET", server.URL+"/test/services", nil)
+	assert.Nil(t, err)
+
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "", req.Header.Get("Authorization"), "The caller's request was modified")
+}
@@ -0,0 +1,267 @@
+package triton
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+	"triton/cloudapi"
+)
+
+const (
+	// ModeSdcDocker registers the machine against the shared sdc-docker
+	// endpoint of the datacenter (the default).
+	ModeSdcDocker = "sdc-docker"
+	// ModeInstance provisions a dedicated Triton instance running Docker.
+	ModeInstance = "instance"
+
+	TritonDefaultSSHUser = "root"
+)
+
+// How often and how long to poll CloudAPI while waiting for an instance to
+// change state, variables so that tests don't have to wait.
+var (
+	machinePollInterval = 5 * time.Second
+	machineStateTimeout = 10 * time.Minute
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsInstance reports whether the machine is backed by a dedicated Triton
+// instance rather than the shared sdc-docker endpoint.
+func (d *Driver) IsInstance() bool {
+	return d.Mode == ModeInstance
+}
+
+// resolveImage returns the image UUID for d.Image, which may either be a
+// UUID or an image name (in which case the most recently published image
+// with that name is used).
+func (d *Driver) resolveImage() (string, error) {
+	if uuidRegexp.MatchString(d.Image) {
+		return d.Image, nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return "", err
+	}
+	images, err := client.ListImages(context.Background(), &cloudapi.ListImagesInput{Name: d.Image})
+	if err != nil {
+		return "", err
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("No image named %q was found in %s", d.Image, d.CloudApiURL)
+	}
+
+	latest := images[0]
+	for _, img := range images[1:] {
+		if img.PublishedAt.After(latest.PublishedAt) {
+			latest = img
+		}
+	}
+	log.Debugf("Resolved image %s to %s (version %s)", d.Image, latest.Id, latest.Version)
+
+	return latest.Id, nil
+}
+
+// getMachine fetches the CloudAPI machine backing this driver.
+func (d *Driver) getMachine() (*cloudapi.Machine, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetMachine(context.Background(), d.InstanceId)
+}
+
+// waitForMachineState polls CloudAPI until the instance reaches the target
+// state, returning the last seen machine.
+func (d *Driver) waitForMachineState(target string, timeout time.Duration) (*cloudapi.Machine, error) {
+	return d.waitForMachineStateSince(target, time.Time{}, timeout)
+}
+
+// waitForMachineStateSince polls CloudAPI until the instance reaches the
+// target state again after since, the time it was last updated before an
+// action that leaves it in the same state (a reboot). Either its update
+// time or having seen it in another state tells that the action happened.
+func (d *Driver) waitForMachineStateSince(target string, since time.Time, timeout time.Duration) (*cloudapi.Machine, error) {
+	deadline := time.Now().Add(timeout)
+	changed := since.IsZero()
+
+	for {
+		m, err := d.getMachine()
+		if target == "deleted" && cloudapi.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Debugf("Instance %s is %s (waiting for %s)", d.InstanceId, m.State, target)
+
+		if m.State != target || m.Updated.After(since) {
+			changed = true
+		}
+		if m.State == target && changed {
+			return m, nil
+		}
+		if m.State == "failed" {
+			return m, fmt.Errorf("Instance %s failed while waiting for it to be %s", d.InstanceId, target)
+		}
+		if time.Now().After(deadline) {
+			return m, fmt.Errorf("Timed out after %s waiting for instance %s to be %s (currently %s)",
+				timeout, d.InstanceId, target, m.State)
+		}
+
+		time.Sleep(machinePollInterval)
+	}
+}
+
+// createInstance provisions a new Triton instance for this machine and
+// waits for it to be running. Docker itself is installed and configured
+// over SSH by the docker-machine provisioner once Create returns.
+func (d *Driver) createInstance() error {
+	imageId, err := d.resolveImage()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating Triton instance %s (image %s, package %s)...", d.MachineName, d.Image, d.Package)
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	m, err := client.CreateMachine(context.Background(), &cloudapi.CreateMachineInput{
+		Name:    d.MachineName,
+		Image:   imageId,
+		Package: d.Package,
+	})
+	if err != nil {
+		return err
+	}
+	d.InstanceId = m.Id
+	log.Debugf("Created instance %s", d.InstanceId)
+
+	log.Infof("Waiting for instance %s to be running...", d.InstanceId)
+	running, err := d.waitForMachineState("running", machineStateTimeout)
+	if err != nil {
+		return d.abandonInstance(err)
+	}
+	if running.PrimaryIp == "" {
+		return d.abandonInstance(fmt.Errorf("Instance %s has no primary IP address", d.InstanceId))
+	}
+	d.IPAddress = running.PrimaryIp
+
+	return nil
+}
+
+// abandonInstance deletes the instance of a failed Create and returns the
+// cause. docker-machine doesn't save the machine when Create fails, so
+// 'docker-machine rm' couldn't find the instance later on.
+func (d *Driver) abandonInstance(cause error) error {
+	log.Infof("Deleting instance %s of the failed create...", d.InstanceId)
+	client, err := d.getClient()
+	if err == nil {
+		err = client.DeleteMachine(context.Background(), d.InstanceId)
+	}
+	if err != nil && !cloudapi.IsNotFound(err) {
+		log.Warnf("Unable to delete instance %s, delete it with 'triton instance delete %s': %s", d.InstanceId, d.InstanceId, err)
+	}
+	return cause
+}
+
+// machineStates maps CloudAPI machine states to docker-machine states.
+var machineStates = map[string]state.State{
+	"provisioning": state.Starting,
+	"running":      state.Running,
+	"stopping":     state.Stopping,
+	"stopped":      state.Stopped,
+	"deleted":      state.None,
+	"failed":       state.Error,
+	"offline":      state.Error,
+}
+
+// getInstanceState returns the docker-machine state of the instance as
+// reported by CloudAPI.
+func (d *Driver) getInstanceState() (state.State, error) {
+	if d.InstanceId == "" {
+		return state.None, nil
+	}
+
+	m, err := d.getMachine()
+	if cloudapi.IsNotFound(err) {
+		return state.None, nil
+	}
+	if err != nil {
+		return state.Error, err
+	}
+
+	st, ok := machineStates[m.State]
+	if !ok {
+		return state.Error, fmt.Errorf("Instance %s is in unknown state %q", d.InstanceId, m.State)
+	}
+	return st, nil
+}
+
+// machineAction triggers a CloudAPI machine action (start, stop, reboot)
+// on the instance and waits for it to reach the target state.
+func (d *Driver) machineAction(action string, target string) error {
+	if d.InstanceId == "" {
+		return fmt.Errorf("Machine %s has no Triton instance", d.MachineName)
+	}
+
+	// The instance is still reported as running right after a reboot
+	// request, so remember when it last changed to wait for the reboot.
+	var since time.Time
+	if action == "reboot" {
+		m, err := d.getMachine()
+		if err != nil {
+			return err
+		}
+		since = m.Updated
+	}
+
+	log.Debugf("Requesting %s of instance %s", action, d.InstanceId)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	err = client.MachineAction(context.Background(), d.InstanceId, action)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Waiting for instance %s to be %s...", d.InstanceId, target)
+	_, err = d.waitForMachineStateSince(target, since, machineStateTimeout)
+
+	return err
+}
+
+// removeInstance deletes the instance backing this machine and waits for
+// CloudAPI to report it as deleted. An instance that is already gone is not
+// an error.
+func (d *Driver) removeInstance() error {
+	if d.InstanceId == "" {
+		return nil
+	}
+
+	log.Infof("Deleting Triton instance %s...", d.InstanceId)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	err = client.DeleteMachine(context.Background(), d.InstanceId)
+	if cloudapi.IsNotFound(err) {
+		log.Infof("Instance %s is already gone", d.InstanceId)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = d.waitForMachineState("deleted", machineStateTimeout)
+
+	return err
+}
@@ -0,0 +1,334 @@
+package triton
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+const testInstanceId = "7b0f8a7e-d6e4-11e5-8d4f-3b1a2c4d5e6f"
+
+// newInstanceServer serves a CloudAPI with two versions of the docker-host
+// image, creating the instance testInstanceId which is provisioning when
+// first polled and then the running machine given. The requests received
+// are recorded as "<method> <path>".
+func newInstanceServer(t *testing.T, running string, requests *[]string) *httptest.Server {
+	polled := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/test/images", func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.Method+" "+r.URL.Path)
+		assert.Equal(t, "docker-host", r.URL.Query().Get("name"))
+		w.Write([]byte(`[
+			{"id":"2d2f4a86-d6e4-11e5-a1a1-6f6a3b5b3b5b","name":"docker-host","version":"1.0.0","published_at":"2016-01-12T10:00:00Z"},
+			{"id":"41f3bb10-d6e4-11e5-b5c6-1b2a3f4e5d6c","name":"docker-host","version":"1.1.0","published_at":"2016-02-10T10:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/test/machines", func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.Method+" "+r.URL.Path)
+		var body map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "test-machine", body["name"])
+		assert.Equal(t, "41f3bb10-d6e4-11e5-b5c6-1b2a3f4e5d6c", body["image"], "Didn't create the latest image")
+		assert.Equal(t, "g4-highcpu-1G", body["package"])
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"` + testInstanceId + `","name":"test-machine","state":"provisioning"}`))
+	})
+	mux.HandleFunc("/test/machines/"+testInstanceId, func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.Method+" "+r.URL.Path)
+		if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !polled {
+			polled = true
+			w.Write([]byte(`{"id":"` + testInstanceId + `","name":"test-machine","state":"provisioning"}`))
+			return
+		}
+		w.Write([]byte(running))
+	})
+	return httptest.NewServer(mux)
+}
+
+func newInstanceDriver(server *httptest.Server) *Driver {
+	return &Driver{
+		BaseDriver:  &drivers.BaseDriver{MachineName: "test-machine"},
+		Account:     "test",
+		PrivateKey:  "../../fixup/id_rsa",
+		CloudApiURL: server.URL,
+		Mode:        ModeInstance,
+		Image:       "docker-host",
+		Package:     "g4-highcpu-1G",
+	}
+}
+
+// shortenMachinePolling makes waiting for instances fast and returns a
+// function restoring the defaults.
+func shortenMachinePolling() func() {
+	interval, timeout := machinePollInterval, machineStateTimeout
+	machinePollInterval, machineStateTimeout = time.Millisecond, time.Second
+	return func() {
+		machinePollInterval, machineStateTimeout = interval, timeout
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	defer shortenMachinePolling()()
+
+	var requests []string
+	server := newInstanceServer(t, `{"id":"`+testInstanceId+`","name":"test-machine","state":"running",
+		"primaryIp":"165.225.128.12","ips":["10.112.2.31","165.225.128.12"]}`, &requests)
+	defer server.Close()
+
+	d := newInstanceDriver(server)
+	assert.Nil(t, d.createInstance())
+	assert.Equal(t, testInstanceId, d.InstanceId)
+	assert.Equal(t, "165.225.128.12", d.IPAddress, "Didn't use the public IP address")
+	assert.Equal(t, []string{
+		"GET /test/images",
+		"POST /test/machines",
+		"GET /test/machines/" + testInstanceId,
+		"GET /test/machines/" + testInstanceId,
+	}, requests, "Didn't wait for the instance to be running, or deleted it")
+}
+
+func TestCreateInstanceDeletesFailedInstance(t *testing.T) {
+	defer shortenMachinePolling()()
+
+	var requests []string
+	server := newInstanceServer(t, `{"id":"`+testInstanceId+`","name":"test-machine","state":"running"}`, &requests)
+	defer server.Close()
+
+	err := newInstanceDriver(server).createInstance()
+	assert.NotNil(t, err, "Created an instance without IP address")
+	assert.Contains(t, err.Error(), "no primary IP address")
+	assert.Contains(t, requests, "DELETE /test/machines/"+testInstanceId, "The instance of the failed create was left behind")
+}
+
+// testState is a state of the instance reported by machineApi, or an error
+// status when it is gone.
+type testState struct {
+	State   string
+	Updated string
+	Status  int
+}
+
+// machineApi fakes the CloudAPI machine testInstanceId. GETs report the
+// queued states in turn, the last one repeatedly, and actions (and
+// "delete") queue the states the instance goes through next. The requests
+// are recorded as "get", "delete" or the action.
+type machineApi struct {
+	t            *testing.T
+	states       []testState
+	next         map[string][]testState
+	deleteStatus int
+	requests     []string
+}
+
+func (api *machineApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(api.t, "/test/machines/"+testInstanceId, r.URL.Path)
+
+	var status int
+	switch r.Method {
+	case "GET":
+		api.requests = append(api.requests, "get")
+		st := api.states[0]
+		if len(api.states) > 1 {
+			api.states = api.states[1:]
+		}
+		if st.Status != 0 {
+			status = st.Status
+			break
+		}
+		m := map[string]string{"id": testInstanceId, "name": "test-machine", "state": st.State}
+		if st.Updated != "" {
+			m["updated"] = st.Updated
+		}
+		json.NewEncoder(w).Encode(m)
+		return
+	case "POST":
+		action := r.URL.Query().Get("action")
+		api.requests = append(api.requests, action)
+		api.states = api.next[action]
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case "DELETE":
+		api.requests = append(api.requests, "delete")
+		if api.deleteStatus == 0 {
+			api.states = api.next["delete"]
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		status = api.deleteStatus
+	}
+
+	w.WriteHeader(status)
+	w.Write([]byte(`{"code":"ResourceNotFound","message":"VM not found"}`))
+}
+
+func newMachineDriver(api *machineApi) (*Driver, func()) {
+	server := httptest.NewServer(api)
+	d := newInstanceDriver(server)
+	d.InstanceId = testInstanceId
+	return d, server.Close
+}
+
+func TestMachineActions(t *testing.T) {
+	defer shortenMachinePolling()()
+
+	for _, test := range []struct {
+		name   string
+		run    func(d *Driver) error
+		action string
+		states []testState
+	}{
+		{"start", (*Driver).Start, "start", []testState{{State: "stopped"}, {State: "running"}}},
+		{"stop", (*Driver).Stop, "stop", []testState{{State: "stopping"}, {State: "stopped"}}},
+		{"kill", (*Driver).Kill, "stop", []testState{{State: "stopping"}, {State: "stopped"}}},
+		{"restart", (*Driver).Restart, "reboot", []testState{{State: "stopping"}, {State: "running"}}},
+	} {
+		api := &machineApi{t: t, states: []testState{{State: "running"}}, next: map[string][]testState{test.action: test.states}}
+		d, done := newMachineDriver(api)
+
+		assert.Nil(t, test.run(d), test.name)
+		assert.Equal(t, test.action, api.requests[len(api.requests)-3], test.name)
+		assert.Equal(t, []string{"get", "get"}, api.requests[len(api.requests)-2:], test.name+" didn't wait for the instance")
+		done()
+	}
+}
+
+func TestRestartWaitsForReboot(t *testing.T) {
+	defer shortenMachinePolling()()
+
+	// The instance is reported running before and right after the reboot,
+	// only its update time tells the reboot happened.
+	api := &machineApi{
+		t:      t,
+		states: []testState{{State: "running", Updated: "2016-02-15T18:18:13Z"}},
+		next: map[string][]testState{"reboot": {
+			{State: "running", Updated: "2016-02-15T18:18:13Z"},
+			{State: "running", Updated: "2016-02-15T18:20:42Z"},
+		}},
+	}
+	d, done := newMachineDriver(api)
+	defer done()
+
+	assert.Nil(t, d.Restart())
+	assert.Equal(t, []string{"get", "reboot", "get", "get"}, api.requests, "Didn't wait for the reboot")
+}
+
+func TestMachineActionTimeout(t *testing.T) {
+	defer shortenMachinePolling()()
+	machineStateTimeout = 20 * time.Millisecond
+
+	api := &machineApi{t: t, states: []testState{{State: "running"}}, next: map[string][]testState{"stop": {{State: "stopping"}}}}
+	d, done := newMachineDriver(api)
+	defer done()
+
+	err := d.Stop()
+	assert.NotNil(t, err, "Didn't time out")
+	assert.Contains(t, err.Error(), "Timed out")
+	assert.Contains(t, err.Error(), "currently stopping")
+}
+
+func TestMachineActionFailed(t *testing.T) {
+	defer shortenMachinePolling()()
+
+	api := &machineApi{t: t, states: []testState{{State: "stopped"}}, next: map[string][]testState{"start": {{State: "failed"}}}}
+	d, done := newMachineDriver(api)
+	defer done()
+
+	err := d.Start()
+	assert.NotNil(t, err, "Didn't report the failed instance")
+	assert.Contains(t, err.Error(), "failed while waiting for it to be running")
+}
+
+func TestMachineActionsWithoutInstance(t *testing.T) {
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test-machine"}, Mode: ModeInstance}
+
+	assert.NotNil(t, d.Start())
+	assert.NotNil(t, (&Driver{}).Stop(), "Stopped an sdc-docker machine")
+}
+
+func TestRemoveInstance(t *testing.T) {
+	defer shortenMachinePolling()()
+
+	for _, deleted := range []testState{{State: "deleted"}, {Status: http.StatusNotFound}} {
+		api := &machineApi{
+			t:      t,
+			states: []testState{{State: "running"}},
+			next:   map[string][]testState{"delete": {{State: "running"}, deleted}},
+		}
+		d, done := newMachineDriver(api)
+
+		assert.Nil(t, d.removeInstance())
+		assert.Equal(t, []string{"delete", "get", "get"}, api.requests, "Didn't wait for the instance to be deleted")
+		done()
+	}
+}
+
+func TestRemoveInstanceAlreadyGone(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		api := &machineApi{t: t, deleteStatus: status}
+		d, done := newMachineDriver(api)
+
+		assert.Nil(t, d.removeInstance(), "Failed to remove an instance that is gone")
+		assert.Equal(t, []string{"delete"}, api.requests)
+		done()
+	}
+}
+
+func TestRemoveInstanceFailure(t *testing.T) {
+	api := &machineApi{t: t, deleteStatus: http.StatusForbidden}
+	d, done := newMachineDriver(api)
+	defer done()
+
+	assert.NotNil(t, d.removeInstance(), "Ignored the failed delete")
+}
+
+func TestGetInstanceState(t *testing.T) {
+	for _, test := range []struct {
+		reported testState
+		expected state.State
+	}{
+		{testState{State: "provisioning"}, state.Starting},
+		{testState{State: "running"}, state.Running},
+		{testState{State: "stopping"}, state.Stopping},
+		{testState{State: "stopped"}, state.Stopped},
+		{testState{State: "deleted"}, state.None},
+		{testState{State: "failed"}, state.Error},
+		{testState{State: "offline"}, state.Error},
+		{testState{Status: http.StatusNotFound}, state.None},
+		{testState{Status: http.StatusGone}, state.None},
+	} {
+		api := &machineApi{t: t, states: []testState{test.reported}}
+		d, done := newMachineDriver(api)
+
+		st, err := d.GetState()
+		assert.Nil(t, err, test.reported.State)
+		assert.Equal(t, test.expected, st, test.reported.State)
+		done()
+	}
+}
+
+func TestGetInstanceStateUnknown(t *testing.T) {
+	api := &machineApi{t: t, states: []testState{{State: "migrating"}}}
+	d, done := newMachineDriver(api)
+	defer done()
+
+	st, err := d.GetState()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `unknown state "migrating"`)
+	assert.Equal(t, state.Error, st)
+}
+
+func TestGetInstanceStateWithoutInstance(t *testing.T) {
+	st, err := (&Driver{Mode: ModeInstance}).GetState()
+	assert.Nil(t, err)
+	assert.Equal(t, state.None, st)
+}
@@ -0,0 +1,138 @@
+package triton
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// Forms of the key fingerprint used as the key id of CloudAPI requests.
+const (
+	KeyIdFormatMD5    = "md5"
+	KeyIdFormatSHA256 = "sha256"
+)
+
+// KeyIdFingerprint returns the fingerprint of key in the given key id
+// format, the colon separated MD5 form or the "SHA256:<base64>" form.
+func KeyIdFingerprint(key ssh.PublicKey, format string) (string, error) {
+	switch format {
+	case KeyIdFormatMD5:
+		return ssh.FingerprintLegacyMD5(key), nil
+	case KeyIdFormatSHA256:
+		return ssh.FingerprintSHA256(key), nil
+	default:
+		return "", fmt.Errorf("Unknown key id format %q, expected %q or %q", format, KeyIdFormatMD5, KeyIdFormatSHA256)
+	}
+}
+
+// otherKeyIdFormat returns the key id format to fall back to when CloudAPI
+// rejects format.
+func otherKeyIdFormat(format string) string {
+	if format == KeyIdFormatSHA256 {
+		return KeyIdFormatMD5
+	}
+	return KeyIdFormatSHA256
+}
+
+// LoadSshPublicKey loads an OpenSSH (authorized_keys format) public key.
+func LoadSshPublicKey(path string) (ssh.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse SSH public key %s: %s", path, err)
+	}
+	return key, nil
+}
+
+// publicKeyOf returns the SSH public key of a private key.
+func publicKeyOf(key interface{}) (ssh.PublicKey, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported private key type %T", key)
+	}
+	return ssh.NewPublicKey(signer.Public())
+}
+
+// checkPublicKeyFile warns when the public key file next to a private key
+// exists but holds another key.
+func checkPublicKeyFile(path string, key ssh.PublicKey) {
+	pub, err := LoadSshPublicKey(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Warnf("Ignoring the public key file %s: %s", path, err)
+		return
+	}
+	if !bytes.Equal(pub.Marshal(), key.Marshal()) {
+		log.Warnf("The public key file %s (%s) doesn't match its private key (%s), using the private key",
+			path, ssh.FingerprintSHA256(pub), ssh.FingerprintSHA256(key))
+	}
+}
+
+// resolveKey turns the --triton-key value into a private key path or an
+// ssh-agent fingerprint. The key may be given as a path, as the name of a
+// key in sshDir (e.g. "id_ecdsa") or as an MD5 or SHA256 fingerprint.
+// Fingerprints are left to ssh-agent when one is running, otherwise the
+// matching key is looked up in sshDir.
+func resolveKey(key string, sshDir string) (string, error) {
+	if _, err := os.Stat(key); err == nil {
+		return key, nil
+	}
+
+	if IsKeyFingerprint(key) {
+		if os.Getenv("SSH_AUTH_SOCK") != "" {
+			return key, nil
+		}
+		log.Debugf("SSH_AUTH_SOCK is not set, looking for the key %s in %s", key, sshDir)
+		return findKeyByFingerprint(sshDir, key)
+	}
+
+	if sshDir != "" && !strings.ContainsRune(key, filepath.Separator) {
+		named := filepath.Join(sshDir, key)
+		if _, err := os.Stat(named); err == nil {
+			return named, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unable to access SSH key file %s", key)
+}
+
+// findKeyByFingerprint returns the path of the private key in dir whose
+// .pub sibling has the given fingerprint.
+func findKeyByFingerprint(dir string, fingerprint string) (string, error) {
+	pubs, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return "", err
+	}
+
+	for _, pub := range pubs {
+		key, err := LoadSshPublicKey(pub)
+		if err != nil {
+			log.Debugf("Skipping %s: %s", pub, err)
+			continue
+		}
+		if !keyMatchesFingerprint(key, fingerprint) {
+			continue
+		}
+
+		privateKey := strings.TrimSuffix(pub, ".pub")
+		if _, err := os.Stat(privateKey); err != nil {
+			return "", fmt.Errorf("Found the public key %s for %s but not its private key", pub, fingerprint)
+		}
+		return privateKey, nil
+	}
+
+	return "", fmt.Errorf("No SSH key with fingerprint %s in %s and SSH_AUTH_SOCK is not set", fingerprint, dir)
+}
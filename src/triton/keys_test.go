@@ -0,0 +1,164 @@
+package triton
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyIdFingerprint(t *testing.T) {
+	key, err := LoadSshPublicKey("../../fixup/id_rsa.pub")
+	assert.Nil(t, err, "Can't load public key")
+
+	fingerprint, err := KeyIdFingerprint(key, KeyIdFormatMD5)
+	assert.Nil(t, err)
+	assert.Equal(t, "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", fingerprint)
+
+	fingerprint, err = KeyIdFingerprint(key, KeyIdFormatSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA", fingerprint)
+
+	_, err = KeyIdFingerprint(key, "sha1")
+	assert.NotNil(t, err, "Accepted an unknown key id format")
+}
+
+func TestKeyIdFingerprintWithPasswordProtectedKey(t *testing.T) {
+	rawkey, err := LoadRawPrivateKey("../../fixup/pass_id_rsa", "testing")
+	assert.Nil(t, err, "Can't load private key")
+	key, err := publicKeyOf(rawkey)
+	assert.Nil(t, err)
+
+	fingerprint, err := KeyIdFingerprint(key, KeyIdFormatMD5)
+	assert.Nil(t, err)
+	assert.Equal(t, "25:ac:dd:f0:b2:f8:f3:9b:df:69:d7:32:5f:87:6b:e2", fingerprint)
+
+	fingerprint, err = KeyIdFingerprint(key, KeyIdFormatSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, "SHA256:AqvxQFaxe4AXENl1StKEAPJzeIQ/OuI7RbCm3JEdljM", fingerprint)
+
+	// The same as of the public key file.
+	id, err := GetSshKeyId("../../fixup/pass_id_rsa.pub")
+	assert.Nil(t, err)
+	assert.Equal(t, "25:ac:dd:f0:b2:f8:f3:9b:df:69:d7:32:5f:87:6b:e2", id)
+}
+
+func TestResolveKey(t *testing.T) {
+	ssh_auth_sock := os.Getenv("SSH_AUTH_SOCK")
+	os.Unsetenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", ssh_auth_sock)
+
+	for key, expected := range map[string]string{
+		"../../fixup/id_rsa": "../../fixup/id_rsa",
+		"id_ecdsa":           "../../fixup/id_ecdsa",
+		"22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42":     "../../fixup/id_rsa",
+		"MD5:79:6f:a9:fe:7c:cc:e2:70:06:e6:73:c6:5b:67:d5:78": "../../fixup/id_ecdsa",
+		"SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA":  "../../fixup/id_rsa",
+	} {
+		resolved, err := resolveKey(key, "../../fixup")
+		assert.Nil(t, err, key)
+		assert.Equal(t, expected, resolved, key)
+	}
+
+	for _, key := range []string{
+		"id_missing",
+		"../../fixup/id_missing",
+		"aa:bb:cc:dd:ee:ff:00:11:22:33:44:55:66:77:88:99",
+	} {
+		_, err := resolveKey(key, "../../fixup")
+		assert.NotNil(t, err, key)
+	}
+}
+
+func TestResolveKeyLeavesFingerprintsToAgent(t *testing.T) {
+	ssh_auth_sock := os.Getenv("SSH_AUTH_SOCK")
+	os.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	defer os.Setenv("SSH_AUTH_SOCK", ssh_auth_sock)
+
+	resolved, err := resolveKey("22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", "../../fixup")
+	assert.Nil(t, err)
+	assert.Equal(t, "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", resolved)
+}
+
+func TestKeyIdFallback(t *testing.T) {
+	var key_ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params, err := ParseAuthorizationHeader(r.Header.Get("Authorization"))
+		assert.Nil(t, err, "Can't parse header")
+		key_ids = append(key_ids, params.KeyId)
+
+		// Only the SHA256 form is accepted, as on a host rejecting MD5.
+		if !strings.Contains(params.KeyId, "/keys/SHA256:") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"InvalidCredentials","message":"Invalid key id"}`))
+			return
+		}
+		w.Write([]byte(`{"docker":"tcp://docker.test:2376"}`))
+	}))
+	defer server.Close()
+
+	d := &Driver{Account: "test", PrivateKey: "../../fixup/id_rsa", CloudApiURL: server.URL}
+
+	client, err := d.getClient()
+	assert.Nil(t, err)
+	services, err := client.ListServices(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://docker.test:2376", services["docker"])
+	assert.Equal(t, KeyIdFormatSHA256, d.KeyIdFormat, "The accepted key id format wasn't kept")
+
+	_, err = client.ListServices(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"/test/keys/22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42",
+		"/test/keys/SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA",
+		"/test/keys/SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA",
+	}, key_ids)
+}
+
+func TestKeyIdWithoutMatchingPublicKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "triton-keys")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key_data, err := ioutil.ReadFile("../../fixup/id_rsa")
+	assert.Nil(t, err)
+	ssh_private_key_path := filepath.Join(dir, "id_rsa")
+	assert.Nil(t, ioutil.WriteFile(ssh_private_key_path, key_data, 0600))
+
+	// Without a .pub file.
+	d := &Driver{Account: "test", PrivateKey: ssh_private_key_path}
+	key_id, err := d.getKeyId(KeyIdFormatMD5)
+	assert.Nil(t, err, "Can't derive the key id from the private key")
+	assert.Equal(t, "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", key_id)
+
+	// With the .pub file of another key.
+	pub_data, err := ioutil.ReadFile("../../fixup/id_ecdsa.pub")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(ssh_private_key_path+".pub", pub_data, 0644))
+
+	d = &Driver{Account: "test", PrivateKey: ssh_private_key_path}
+	key_id, err = d.getKeyId(KeyIdFormatSHA256)
+	assert.Nil(t, err, "Can't derive the key id from the private key")
+	assert.Equal(t, "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA", key_id)
+}
+
+func TestSubUserKeyId(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://cloudapi.test/test/services", nil)
+	assert.Nil(t, err)
+
+	d := &Driver{Account: "test", User: "dev", PrivateKey: "../../fixup/id_rsa"}
+	assert.Nil(t, d.signRequest(req), "Can't sign request")
+
+	params, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
+	assert.Nil(t, err, "Can't parse header")
+	assert.Equal(t, "/test/users/dev/keys/22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42", params.KeyId)
+
+	assert.Equal(t, "test/dev", d.login())
+	assert.Equal(t, "test", (&Driver{Account: "test"}).login())
+}
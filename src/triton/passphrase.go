@@ -0,0 +1,48 @@
+package triton
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/term"
+)
+
+// KeyPassphraseEnvVar holds the passphrase of an encrypted private key.
+const KeyPassphraseEnvVar = "SDC_KEY_PASSPHRASE"
+
+// getKeyPassphrase returns the passphrase of the encrypted private key,
+// taken from the --triton-key-passphrase-file, SDC_KEY_PASSPHRASE or, when
+// stdin is a terminal, an interactive prompt that doesn't echo.
+func (d *Driver) getKeyPassphrase() (string, error) {
+	if d.KeyPassphraseFile != "" {
+		log.Debugf("Reading the key passphrase from %s", d.KeyPassphraseFile)
+		data, err := ioutil.ReadFile(d.KeyPassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("Unable to read the key passphrase file: %s", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if passphrase := os.Getenv(KeyPassphraseEnvVar); passphrase != "" {
+		log.Debugf("Using the key passphrase from %s", KeyPassphraseEnvVar)
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("The SSH key %s is encrypted and there is no terminal to ask for its passphrase, "+
+			"use --triton-key-passphrase-file or %s", d.PrivateKey, KeyPassphraseEnvVar)
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", d.PrivateKey)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(passphrase), nil
+}
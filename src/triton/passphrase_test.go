@@ -0,0 +1,51 @@
+package triton
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPassphraseFromEnv(t *testing.T) {
+	os.Setenv(KeyPassphraseEnvVar, "testing")
+	defer os.Unsetenv(KeyPassphraseEnvVar)
+
+	d := &Driver{PrivateKey: "../../fixup/pass_id_rsa"}
+	key, err := d.getPrivateKey()
+
+	assert.Nil(t, err, "Can't load private key")
+	assert.NotNil(t, key)
+}
+
+func TestKeyPassphraseFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "triton-passphrase")
+	assert.Nil(t, err, "can't create temp file")
+	defer os.Remove(f.Name())
+	f.WriteString("testing\n")
+	f.Close()
+
+	d := &Driver{PrivateKey: "../../fixup/pass_id_ed25519", KeyPassphraseFile: f.Name()}
+	key, err := d.getPrivateKey()
+
+	assert.Nil(t, err, "Can't load private key")
+	assert.NotNil(t, key)
+}
+
+func TestKeyPassphraseFileOverridesEnv(t *testing.T) {
+	os.Setenv(KeyPassphraseEnvVar, "wrong")
+	defer os.Unsetenv(KeyPassphraseEnvVar)
+
+	f, err := ioutil.TempFile("", "triton-passphrase")
+	assert.Nil(t, err, "can't create temp file")
+	defer os.Remove(f.Name())
+	f.WriteString("testing\n")
+	f.Close()
+
+	d := &Driver{PrivateKey: "../../fixup/pass_id_rsa", KeyPassphraseFile: f.Name()}
+	passphrase, err := d.getKeyPassphrase()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "testing", passphrase)
+}
@@ -0,0 +1,183 @@
+package triton
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ed25519"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted PKCS#8 keys (RFC 5208 / RFC 8018) as written by e.g.
+// "openssl pkcs8 -topk8 -v2 aes-256-cbc". Only the PBES2 scheme with
+// PBKDF2 is supported, which is what every current tool produces.
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHmacWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHmacWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHmacWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHmacWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHmacWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// pbkdf2Hash returns the hash for a PBKDF2 pseudorandom function,
+// defaulting to hmacWithSHA1 as per RFC 8018.
+func pbkdf2Hash(prf pkix.AlgorithmIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(prf.Algorithm) == 0, prf.Algorithm.Equal(oidHmacWithSHA1):
+		return sha1.New, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA224):
+		return sha256.New224, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA256):
+		return sha256.New, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA384):
+		return sha512.New384, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA512):
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("pkcs8: unsupported PBKDF2 PRF %s", prf.Algorithm)
+	}
+}
+
+// pbes2Cipher returns the block cipher constructor and key size for a
+// PBES2 encryption scheme.
+func pbes2Cipher(oid asn1.ObjectIdentifier) (func([]byte) (cipher.Block, error), int, error) {
+	switch {
+	case oid.Equal(oidAES128CBC):
+		return aes.NewCipher, 16, nil
+	case oid.Equal(oidAES192CBC):
+		return aes.NewCipher, 24, nil
+	case oid.Equal(oidAES256CBC):
+		return aes.NewCipher, 32, nil
+	case oid.Equal(oidDESEDE3CBC):
+		return des.NewTripleDESCipher, 24, nil
+	default:
+		return nil, 0, fmt.Errorf("pkcs8: unsupported encryption scheme %s", oid)
+	}
+}
+
+// decryptPKCS8 decrypts the DER of an "ENCRYPTED PRIVATE KEY" block and
+// returns the DER of the plain PKCS#8 key.
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	_, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("pkcs8: unsupported encryption algorithm %s", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	_, err = asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	if err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("pkcs8: unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	if err != nil {
+		return nil, err
+	}
+	prf, err := pbkdf2Hash(kdf.PRF)
+	if err != nil {
+		return nil, err
+	}
+
+	newCipher, keyLen, err := pbes2Cipher(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var iv []byte
+	_, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	if err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key(password, kdf.Salt, kdf.IterationCount, keyLen, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("pkcs8: invalid IV length")
+	}
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("pkcs8: invalid encrypted data length")
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// Strip the PKCS#7 padding, a wrong password almost always shows up
+	// as invalid padding.
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, x509.IncorrectPasswordError
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+
+	return plain[:len(plain)-pad], nil
+}
+
+// parsePKCS8PrivateKey parses a plain PKCS#8 key, returning the same key
+// types as the other private key formats.
+func parsePKCS8PrivateKey(der []byte) (interface{}, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return normalizePrivateKey(key), nil
+}
+
+// normalizePrivateKey returns ed25519 keys by value, as some parsers
+// return a pointer to them.
+func normalizePrivateKey(key interface{}) interface{} {
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		return *k
+	}
+	return key
+}
@@ -0,0 +1,162 @@
+package triton
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/machine/libmachine/log"
+	"triton/cloudapi"
+)
+
+// PreCreateCheck allows for pre-create operations to make sure a driver is
+// ready for creation. It verifies the key, the account and the requested
+// resources with CloudAPI before docker-machine writes the host directory.
+func (d *Driver) PreCreateCheck() error {
+	err := d.checkKey()
+	if err != nil {
+		return err
+	}
+
+	if d.RegisterKey {
+		err = d.registerKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.resolveDataCenter()
+	if err != nil {
+		return d.explainApiError(err)
+	}
+
+	err = d.checkAccountKey()
+	if err != nil {
+		return err
+	}
+
+	if d.IsInstance() {
+		err = d.checkImage()
+		if err != nil {
+			return err
+		}
+		return d.checkPackage()
+	}
+
+	return d.checkDockerService()
+}
+
+// checkKey loads the key used to sign requests. The sdc-docker mode also
+// needs the private key itself to generate the client certificate.
+func (d *Driver) checkKey() error {
+	if !d.IsInstance() && d.UsesAgent() {
+		return fmt.Errorf("The %s mode generates the client certificate from the private key, which ssh-agent doesn't give out: "+
+			"pass the path of the private key file of %s using --triton-key, or use --triton-mode=%s", ModeSdcDocker, d.PrivateKey, ModeInstance)
+	}
+
+	var err error
+	if d.IsInstance() {
+		_, err = d.getSigner()
+	} else {
+		_, err = d.getPrivateKey()
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to load the SSH key %s: %s", d.PrivateKey, err)
+	}
+	return nil
+}
+
+// explainApiError adds the likely cause to authentication failures.
+func (d *Driver) explainApiError(err error) error {
+	switch cloudapi.StatusCode(err) {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("CloudAPI at %s didn't accept the key %s for %s, check --triton-account, --triton-user and that the key was added to the account: %s",
+			d.CloudApiURL, d.PrivateKey, d.login(), err)
+	case http.StatusForbidden:
+		return fmt.Errorf("%s is not allowed to use CloudAPI at %s, check its RBAC roles (--triton-role): %s",
+			d.login(), d.CloudApiURL, err)
+	}
+	return err
+}
+
+// checkAccountKey verifies the key is one of the keys of the account (or
+// sub-user), so a key that was never added is reported as such rather
+// than as a failed request later on.
+func (d *Driver) checkAccountKey() error {
+	publicKey, err := d.getPublicKey()
+	if err != nil {
+		return err
+	}
+
+	keys, err := d.listKeys()
+	if cloudapi.StatusCode(err) == http.StatusForbidden {
+		// Sub-users aren't necessarily allowed to list keys, the
+		// signed request succeeding is as good a check.
+		log.Debugf("Not allowed to list the keys of %s, skipping the key check", d.login())
+		return nil
+	}
+	if err != nil {
+		return d.explainApiError(err)
+	}
+
+	if key := findKey(keys, publicKey); key != nil {
+		log.Debugf("Key %s is the %s key %q", d.PrivateKey, d.login(), key.Name)
+		return nil
+	}
+
+	sha256Fingerprint, _ := KeyIdFingerprint(publicKey, KeyIdFormatSHA256)
+	return fmt.Errorf("The key %s (%s) is not one of the keys of %s, add it with 'triton key add', in the portal or using --triton-register-key",
+		d.PrivateKey, sha256Fingerprint, d.login())
+}
+
+// checkDockerService verifies the datacenter offers sdc-docker to the
+// account.
+func (d *Driver) checkDockerService() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	services, err := client.ListServices(context.Background())
+	if err != nil {
+		return d.explainApiError(err)
+	}
+	if _, ok := services["docker"]; !ok {
+		return fmt.Errorf("Docker is not available to %s in %s, use --triton-mode=%s to run it on a dedicated instance",
+			d.login(), d.CloudApiURL, ModeInstance)
+	}
+	return nil
+}
+
+// checkImage verifies the instance image exists.
+func (d *Driver) checkImage() error {
+	if !uuidRegexp.MatchString(d.Image) {
+		_, err := d.resolveImage()
+		if err != nil {
+			return fmt.Errorf("%s, list the images with 'triton images'", err)
+		}
+		return nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.GetImage(context.Background(), d.Image)
+	if cloudapi.IsNotFound(err) {
+		return fmt.Errorf("No image %s was found in %s, list the images with 'triton images'", d.Image, d.CloudApiURL)
+	}
+	return err
+}
+
+// checkPackage verifies the instance package exists.
+func (d *Driver) checkPackage() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.GetPackage(context.Background(), d.Package)
+	if cloudapi.IsNotFound(err) {
+		return fmt.Errorf("No package %q was found in %s, list the packages with 'triton packages'", d.Package, d.CloudApiURL)
+	}
+	return err
+}
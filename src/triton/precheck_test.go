@@ -0,0 +1,135 @@
+package triton
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPreCreateServer serves a CloudAPI for the test account with the given
+// keys and services, one datacenter, one image and one package.
+func newPreCreateServer(keys string, services string) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/test/datacenters", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"us-test-1":"` + server.URL + `"}`))
+	})
+	mux.HandleFunc("/test/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(keys))
+	})
+	mux.HandleFunc("/test/users/dev/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"code":"NotAuthorized","message":"You do not have permission"}`))
+	})
+	mux.HandleFunc("/test/services", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(services))
+	})
+	mux.HandleFunc("/test/images", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "ubuntu-16.04" {
+			w.Write([]byte(`[{"id":"2d2f4a86-d6e4-11e5-a1a1-6f6a3b5b3b5b","name":"ubuntu-16.04","version":"20160215"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/test/packages/g4-highcpu-1G", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"d33e2b10-d6e4-11e5-b2b1-0f8a5c8b2b5b","name":"g4-highcpu-1G"}`))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"ResourceNotFound","message":"` + r.URL.Path + ` does not exist"}`))
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+const (
+	testAccountKeys = `[{"name":"laptop","fingerprint":"22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42"}]`
+	testServices    = `{"cloudapi":"https://us-test-1.api.example.com","docker":"tcp://us-test-1.docker.example.com"}`
+)
+
+func newPreCreateDriver(server *httptest.Server) *Driver {
+	return &Driver{
+		Account:     "test",
+		PrivateKey:  "../../fixup/id_rsa",
+		CloudApiURL: server.URL,
+		DataCenter:  "us-test-1",
+		Mode:        ModeSdcDocker,
+	}
+}
+
+func TestPreCreateCheck(t *testing.T) {
+	server := newPreCreateServer(testAccountKeys, testServices)
+	defer server.Close()
+
+	assert.Nil(t, newPreCreateDriver(server).PreCreateCheck())
+
+	d := newPreCreateDriver(server)
+	d.Mode = ModeInstance
+	d.Image = "ubuntu-16.04"
+	d.Package = "g4-highcpu-1G"
+	assert.Nil(t, d.PreCreateCheck())
+
+	// Sub-users that can't list their keys skip the key check.
+	d = newPreCreateDriver(server)
+	d.User = "dev"
+	assert.Nil(t, d.PreCreateCheck())
+}
+
+func TestPreCreateCheckUnknownKey(t *testing.T) {
+	server := newPreCreateServer(`[{"name":"other","fingerprint":"25:ac:dd:f0:b2:f8:f3:9b:df:69:d7:32:5f:87:6b:e2"}]`, testServices)
+	defer server.Close()
+
+	err := newPreCreateDriver(server).PreCreateCheck()
+	assert.NotNil(t, err, "Accepted a key that isn't on the account")
+	assert.Contains(t, err.Error(), "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA")
+}
+
+func TestPreCreateCheckWithoutDocker(t *testing.T) {
+	server := newPreCreateServer(testAccountKeys, `{"cloudapi":"https://us-test-1.api.example.com"}`)
+	defer server.Close()
+
+	err := newPreCreateDriver(server).PreCreateCheck()
+	assert.NotNil(t, err, "Accepted an account without sdc-docker")
+	assert.Contains(t, err.Error(), "--triton-mode=instance")
+}
+
+func TestPreCreateCheckUnknownImageAndPackage(t *testing.T) {
+	server := newPreCreateServer(testAccountKeys, testServices)
+	defer server.Close()
+
+	d := newPreCreateDriver(server)
+	d.Mode = ModeInstance
+	d.Image = "centos-7"
+	d.Package = "g4-highcpu-1G"
+	err := d.PreCreateCheck()
+	assert.NotNil(t, err, "Accepted an unknown image")
+	assert.Contains(t, err.Error(), "triton images")
+
+	d.Image = "2d2f4a86-d6e4-11e5-a1a1-6f6a3b5b3b5b"
+	err = d.PreCreateCheck()
+	assert.NotNil(t, err, "Accepted an unknown image")
+	assert.Contains(t, err.Error(), "triton images")
+
+	d.Image = "ubuntu-16.04"
+	d.Package = "g4-highcpu-128G"
+	err = d.PreCreateCheck()
+	assert.NotNil(t, err, "Accepted an unknown package")
+	assert.Contains(t, err.Error(), "triton packages")
+}
+
+func TestPreCreateCheckBadKey(t *testing.T) {
+	d := &Driver{Account: "test", PrivateKey: "../../fixup/id_rsa.pub", Mode: ModeSdcDocker}
+	err := d.PreCreateCheck()
+	assert.NotNil(t, err, "Accepted a public key as private key")
+	assert.Contains(t, err.Error(), "Unable to load the SSH key")
+}
+
+func TestPreCreateCheckAgentKeyWithSdcDocker(t *testing.T) {
+	d := &Driver{Account: "test", PrivateKey: "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA", Mode: ModeSdcDocker}
+	err := d.PreCreateCheck()
+	assert.NotNil(t, err, "Accepted an ssh-agent key to generate the client certificate from")
+	assert.Contains(t, err.Error(), "--triton-key")
+	assert.Contains(t, err.Error(), "--triton-mode=instance")
+}
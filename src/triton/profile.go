@@ -0,0 +1,168 @@
+package triton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// TritonEnvProfile is the profile the triton CLI builds from TRITON_*
+// environment variables alone.
+const TritonEnvProfile = "env"
+
+// TritonProfile holds the settings of a triton CLI profile, see
+// https://github.com/joyent/node-triton#configuration.
+type TritonProfile struct {
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Account  string `json:"account"`
+	KeyId    string `json:"keyId"`
+	Insecure bool   `json:"insecure"`
+	User     string `json:"user"`
+}
+
+// tritonConfig is ~/.triton/config.json, naming the current profile.
+type tritonConfig struct {
+	Profile string `json:"profile"`
+}
+
+// tritonConfigDir returns the configuration directory of the triton CLI.
+func tritonConfigDir(homedir string) string {
+	return filepath.Join(homedir, ".triton")
+}
+
+// CurrentTritonProfile returns the name of the profile selected with
+// "triton profile set-current", or "" when there is none.
+func CurrentTritonProfile(configDir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var config tritonConfig
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse %s: %s", filepath.Join(configDir, "config.json"), err)
+	}
+	return config.Profile, nil
+}
+
+// LoadTritonProfile loads the named triton CLI profile from
+// configDir/profiles.d. As with the CLI, TRITON_* environment variables
+// override the settings of the profile, and the "env" profile is made of
+// the environment variables only.
+func LoadTritonProfile(configDir string, name string) (*TritonProfile, error) {
+	profile := &TritonProfile{Name: name}
+
+	if name != TritonEnvProfile {
+		profilePath := filepath.Join(configDir, "profiles.d", name+".json")
+		data, err := ioutil.ReadFile(profilePath)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load triton profile %q: %s", name, err)
+		}
+		err = json.Unmarshal(data, profile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s", profilePath, err)
+		}
+	}
+
+	profile.applyEnv()
+	return profile, nil
+}
+
+// applyEnv overrides the profile settings with TRITON_* environment
+// variables, falling back to their older SDC_* names.
+func (p *TritonProfile) applyEnv() {
+	if v := tritonEnv("URL"); v != "" {
+		p.Url = v
+	}
+	if v := tritonEnv("ACCOUNT"); v != "" {
+		p.Account = v
+	}
+	if v := tritonEnv("KEY_ID"); v != "" {
+		p.KeyId = v
+	}
+	if v := tritonEnv("USER"); v != "" {
+		p.User = v
+	}
+	if v := tritonEnv("TLS_INSECURE"); v != "" {
+		p.Insecure = isTrue(v)
+	}
+}
+
+// tritonEnv returns TRITON_<name>, or SDC_<name> when it isn't set.
+func tritonEnv(name string) string {
+	if v := os.Getenv("TRITON_" + name); v != "" {
+		return v
+	}
+	return os.Getenv("SDC_" + name)
+}
+
+// isTrue parses a boolean environment variable the way the triton CLI
+// does.
+func isTrue(v string) bool {
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// applyTritonProfile fills the settings not given with flags from the
+// triton CLI profile. Without --triton-profile the current profile of the
+// CLI (or the "env" profile) is used, but only when the account isn't given
+// either, so explicitly configured machines are unaffected.
+func (d *Driver) applyTritonProfile(name string, configDir string) error {
+	if name == "" {
+		if d.Account != "" {
+			return nil
+		}
+		current, err := CurrentTritonProfile(configDir)
+		if err != nil {
+			return err
+		}
+		name = current
+		if name == "" {
+			name = TritonEnvProfile
+		}
+	}
+
+	profile, err := LoadTritonProfile(configDir, name)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Using triton profile %s", profile.Name)
+
+	if d.CloudApiURL == "" {
+		d.CloudApiURL = profile.Url
+	}
+	if d.Account == "" {
+		d.Account = profile.Account
+	}
+	if d.PrivateKey == "" {
+		d.PrivateKey = profile.KeyId
+	}
+	if d.User == "" {
+		d.User = profile.User
+	}
+	if profile.Insecure && !d.SkipTlsVerify {
+		// An explicit SDC_SKIP_TLS_VERIFY=false keeps the verification on,
+		// which the boolean flag alone can't tell apart from it being unset.
+		if v := os.Getenv("SDC_SKIP_TLS_VERIFY"); v != "" && !isTrue(v) {
+			log.Debugf("Ignoring the insecure setting of triton profile %s, SDC_SKIP_TLS_VERIFY is %s", profile.Name, v)
+		} else {
+			log.Warnf("The triton profile %s turns off TLS verification of %s, set TRITON_TLS_INSECURE=0 to keep it on", profile.Name, d.CloudApiURL)
+			d.SkipTlsVerify = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package triton
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clearTritonEnv unsets the environment variables overriding profiles and
+// returns a function restoring them.
+func clearTritonEnv() func() {
+	saved := map[string]string{}
+	for _, name := range []string{"URL", "ACCOUNT", "KEY_ID", "USER", "TLS_INSECURE"} {
+		for _, prefix := range []string{"TRITON_", "SDC_"} {
+			saved[prefix+name] = os.Getenv(prefix + name)
+			os.Unsetenv(prefix + name)
+		}
+	}
+	return func() {
+		for k, v := range saved {
+			if v != "" {
+				os.Setenv(k, v)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}
+}
+
+func TestLoadTritonProfile(t *testing.T) {
+	defer clearTritonEnv()()
+
+	profile, err := LoadTritonProfile("../../fixup/triton", "coal")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://10.88.88.3", profile.Url)
+	assert.Equal(t, "admin", profile.Account)
+	assert.Equal(t, "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA", profile.KeyId)
+	assert.True(t, profile.Insecure)
+
+	_, err = LoadTritonProfile("../../fixup/triton", "missing")
+	assert.NotNil(t, err, "Loaded a missing profile")
+}
+
+func TestTritonProfileEnvOverrides(t *testing.T) {
+	defer clearTritonEnv()()
+	os.Setenv("TRITON_ACCOUNT", "override")
+	os.Setenv("SDC_URL", "https://us-east-3b.api.joyent.com")
+	os.Setenv("TRITON_TLS_INSECURE", "0")
+
+	profile, err := LoadTritonProfile("../../fixup/triton", "coal")
+	assert.Nil(t, err)
+	assert.Equal(t, "override", profile.Account)
+	assert.Equal(t, "https://us-east-3b.api.joyent.com", profile.Url)
+	assert.False(t, profile.Insecure)
+
+	profile, err = LoadTritonProfile("../../fixup/triton", TritonEnvProfile)
+	assert.Nil(t, err)
+	assert.Equal(t, "override", profile.Account)
+	assert.Equal(t, "", profile.KeyId)
+}
+
+func TestCurrentTritonProfile(t *testing.T) {
+	current, err := CurrentTritonProfile("../../fixup/triton")
+	assert.Nil(t, err)
+	assert.Equal(t, "dev", current)
+
+	current, err = CurrentTritonProfile("../../fixup/missing")
+	assert.Nil(t, err)
+	assert.Equal(t, "", current)
+}
+
+func TestApplyTritonProfile(t *testing.T) {
+	defer clearTritonEnv()()
+
+	// Flags take precedence over the profile.
+	d := &Driver{Account: "flag"}
+	assert.Nil(t, d.applyTritonProfile("coal", "../../fixup/triton"))
+	assert.Equal(t, "flag", d.Account)
+	assert.Equal(t, "https://10.88.88.3", d.CloudApiURL)
+	assert.Equal(t, "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA", d.PrivateKey)
+	assert.True(t, d.SkipTlsVerify)
+
+	// Without --triton-profile the current profile is used when no
+	// account is given.
+	d = &Driver{}
+	assert.Nil(t, d.applyTritonProfile("", "../../fixup/triton"))
+	assert.Equal(t, "dev", d.Account)
+	assert.Equal(t, "https://us-sw-1.api.joyent.com", d.CloudApiURL)
+
+	d = &Driver{Account: "flag"}
+	assert.Nil(t, d.applyTritonProfile("", "../../fixup/triton"))
+	assert.Equal(t, "", d.CloudApiURL, "Applied the current profile to an explicit configuration")
+
+	// Or the environment alone when the CLI has no current profile.
+	os.Setenv("TRITON_ACCOUNT", "env")
+	d = &Driver{}
+	assert.Nil(t, d.applyTritonProfile("", "../../fixup/missing"))
+	assert.Equal(t, "env", d.Account)
+}
+
+func TestApplyTritonProfileKeepTlsVerify(t *testing.T) {
+	defer clearTritonEnv()()
+
+	os.Setenv("TRITON_TLS_INSECURE", "0")
+	d := &Driver{}
+	assert.Nil(t, d.applyTritonProfile("coal", "../../fixup/triton"))
+	assert.False(t, d.SkipTlsVerify, "TRITON_TLS_INSECURE=0 didn't override the profile")
+	os.Unsetenv("TRITON_TLS_INSECURE")
+
+	os.Setenv("SDC_SKIP_TLS_VERIFY", "false")
+	defer os.Unsetenv("SDC_SKIP_TLS_VERIFY")
+	d = &Driver{}
+	assert.Nil(t, d.applyTritonProfile("coal", "../../fixup/triton"))
+	assert.False(t, d.SkipTlsVerify, "SDC_SKIP_TLS_VERIFY=false didn't override the profile")
+}
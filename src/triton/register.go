@@ -0,0 +1,105 @@
+package triton
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"triton/cloudapi"
+)
+
+// listKeys returns the keys of the account, or of the sub-user.
+func (d *Driver) listKeys() ([]*cloudapi.Key, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	if d.User != "" {
+		return client.ListUserKeys(context.Background(), d.User)
+	}
+	return client.ListKeys(context.Background())
+}
+
+// findKey returns the key of the list matching publicKey, nil if there is
+// none. CloudAPI lists MD5 fingerprints, newer versions SHA256 ones.
+func findKey(keys []*cloudapi.Key, publicKey ssh.PublicKey) *cloudapi.Key {
+	md5Fingerprint, _ := KeyIdFingerprint(publicKey, KeyIdFormatMD5)
+	sha256Fingerprint, _ := KeyIdFingerprint(publicKey, KeyIdFormatSHA256)
+	for _, key := range keys {
+		fingerprint := strings.TrimPrefix(key.Fingerprint, "MD5:")
+		if fingerprint == md5Fingerprint || fingerprint == sha256Fingerprint {
+			return key
+		}
+	}
+	return nil
+}
+
+// withKey returns a copy of the driver authenticating with another key,
+// with the same CloudAPI, TLS and proxy settings.
+func (d *Driver) withKey(key string) *Driver {
+	c := *d
+	c.PrivateKey = key
+	c.privateKey = nil
+	c.publicKey = nil
+	c.signer = nil
+	c.client = nil
+	c.transports = nil
+	return &c
+}
+
+// registerKeyName returns the name the key is added to the account with.
+func (d *Driver) registerKeyName() string {
+	if d.RegisterKeyName != "" {
+		return d.RegisterKeyName
+	}
+	return "docker-machine-" + d.MachineName
+}
+
+// registerKey adds the public key of --triton-key to the account (or
+// sub-user) unless it was added already, authenticating with the
+// --triton-register-key-with key. docker-machine runs the driver without a
+// terminal, so there is no asking which other key to use.
+func (d *Driver) registerKey() error {
+	if d.RegisterKeyWith == "" {
+		return fmt.Errorf("No key to add %s to %s with, pass a key that was already added using --triton-register-key-with",
+			d.PrivateKey, d.login())
+	}
+
+	publicKey, err := d.getPublicKey()
+	if err != nil {
+		return err
+	}
+
+	authorized := d.withKey(d.RegisterKeyWith)
+	keys, err := authorized.listKeys()
+	if err != nil {
+		return fmt.Errorf("Unable to list the keys of %s with %s: %s", d.login(), authorized.PrivateKey, err)
+	}
+	if key := findKey(keys, publicKey); key != nil {
+		log.Debugf("The key %s was already added to %s as %q", d.PrivateKey, d.login(), key.Name)
+		return nil
+	}
+
+	fingerprint := ssh.FingerprintSHA256(publicKey)
+	input := &cloudapi.CreateKeyInput{
+		Name: d.registerKeyName(),
+		Key:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+	}
+	client, err := authorized.getClient()
+	if err != nil {
+		return err
+	}
+	if d.User != "" {
+		_, err = client.CreateUserKey(context.Background(), d.User, input)
+	} else {
+		_, err = client.CreateKey(context.Background(), input)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to add the key %s to %s: %s", d.PrivateKey, d.login(), err)
+	}
+	log.Infof("Added the key %s (%s) to %s as %q", d.PrivateKey, fingerprint, d.login(), input.Name)
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package triton
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"triton/cloudapi"
+)
+
+// newKeysServer serves a CloudAPI accepting requests signed by the keys of
+// the test account, initially only id_rsa, and allowing keys to be added.
+func newKeysServer(t *testing.T) (*httptest.Server, *[]*cloudapi.Key) {
+	keys := []*cloudapi.Key{{Name: "laptop", Fingerprint: "22:62:da:a0:33:12:70:19:db:ac:e1:66:9e:27:20:42"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params, err := ParseAuthorizationHeader(r.Header.Get("Authorization"))
+		assert.Nil(t, err, "Can't parse header")
+
+		authorized := false
+		for _, key := range keys {
+			if strings.HasSuffix(params.KeyId, "/keys/"+key.Fingerprint) {
+				authorized = true
+			}
+		}
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"InvalidCredentials","message":"Invalid key"}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/test/keys":
+			if r.Method == "POST" {
+				var input cloudapi.CreateKeyInput
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Nil(t, json.Unmarshal(body, &input))
+
+				publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(input.Key))
+				assert.Nil(t, err, "Can't parse the added key")
+				key := &cloudapi.Key{Name: input.Name, Key: input.Key, Fingerprint: ssh.FingerprintLegacyMD5(publicKey)}
+				keys = append(keys, key)
+				json.NewEncoder(w).Encode(key)
+				return
+			}
+			json.NewEncoder(w).Encode(keys)
+		case "/test/services":
+			w.Write([]byte(`{"docker":"tcp://us-test-1.docker.example.com:2376"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server, &keys
+}
+
+func newRegisterDriver(server *httptest.Server) *Driver {
+	return &Driver{
+		BaseDriver:  &drivers.BaseDriver{MachineName: "test-machine"},
+		Account:     "test",
+		PrivateKey:  "../../fixup/id_ecdsa",
+		CloudApiURL: server.URL,
+		RegisterKey: true,
+	}
+}
+
+func TestRegisterKeyWith(t *testing.T) {
+	server, keys := newKeysServer(t)
+	defer server.Close()
+
+	d := newRegisterDriver(server)
+	d.RegisterKeyWith = "../../fixup/id_rsa"
+
+	err := d.MakeCloudApiRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://us-test-1.docker.example.com:2376", d.DockerApiURL)
+	assert.Len(t, *keys, 2)
+	assert.Equal(t, "docker-machine-test-machine", (*keys)[1].Name)
+	assert.Equal(t, "79:6f:a9:fe:7c:cc:e2:70:06:e6:73:c6:5b:67:d5:78", (*keys)[1].Fingerprint)
+
+	// The key is only added once.
+	assert.Nil(t, d.registerKey())
+	assert.Len(t, *keys, 2)
+}
+
+func TestRegisterKeyDisabled(t *testing.T) {
+	server, keys := newKeysServer(t)
+	defer server.Close()
+
+	d := newRegisterDriver(server)
+	d.RegisterKey = false
+	d.RegisterKeyWith = "../../fixup/id_rsa"
+
+	assert.NotNil(t, d.MakeCloudApiRequest(), "Accepted a key that wasn't added")
+	assert.Len(t, *keys, 1)
+}
+
+func TestRegisterKeyWithAgentKey(t *testing.T) {
+	server, keys := newKeysServer(t)
+	defer server.Close()
+
+	key, err := LoadRawPrivateKey("../../fixup/id_rsa", "")
+	assert.Nil(t, err, "Can't load private key")
+	_, done := newFakeAgent(t, key)
+	defer done()
+
+	d := newRegisterDriver(server)
+	d.RegisterKeyWith = "SHA256:MgrWsThjKlVmokJ+3HW7xLcWDRrJB3PBr5qQF6UrUHA"
+	assert.Nil(t, d.registerKey())
+	assert.Len(t, *keys, 2)
+}
+
+func TestRegisterKeyWithoutAuthorizedKey(t *testing.T) {
+	server, keys := newKeysServer(t)
+	defer server.Close()
+
+	err := newRegisterDriver(server).registerKey()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "--triton-register-key-with")
+	assert.Len(t, *keys, 1)
+}
+
+func TestRegisterKeyWithCaCert(t *testing.T) {
+	server, keys := newKeysServer(t)
+	server.Close()
+	server = httptest.NewTLSServer(server.Config.Handler)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "triton-register")
+	assert.Nil(t, err, "can't create temp dir")
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "bundle.pem")
+	assert.Nil(t, ioutil.WriteFile(bundle, certificatePem(server.Certificate()), 0644))
+
+	d := newRegisterDriver(server)
+	d.RegisterKeyWith = "../../fixup/id_rsa"
+	d.CaCert = bundle
+
+	assert.Nil(t, d.registerKey(), "The key registration didn't trust --triton-ca-cert")
+	assert.Len(t, *keys, 2)
+}
+
+func TestRegisterKeyWithProxy(t *testing.T) {
+	// The CloudAPI server only answers requests sent through it as proxy.
+	proxy, keys := newKeysServer(t)
+	defer proxy.Close()
+
+	d := newRegisterDriver(proxy)
+	d.CloudApiURL = "http://us-test-1.api.example.invalid"
+	d.Proxy = proxy.URL
+	d.Retries = 0
+	d.RegisterKeyWith = "../../fixup/id_rsa"
+
+	assert.Nil(t, d.registerKey(), "The key registration didn't use --triton-proxy")
+	assert.Len(t, *keys, 2)
+}
@@ -0,0 +1,193 @@
+package triton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// DefaultCertExpiryWarning is the default of --triton-cert-expiry-warning,
+// in days.
+const DefaultCertExpiryWarning = 30
+
+// generateClientCertificate issues the sdc-docker client certificate
+// (key.pem, cert.csr and cert.pem) from the SSH key and records its expiry.
+func (d *Driver) generateClientCertificate() error {
+	key, err := d.getPrivateKey()
+	if err != nil {
+		return err
+	}
+
+	var keyFile = d.ResolveStorePath("key.pem")
+	var csrFile = d.ResolveStorePath("cert.csr")
+	var certFile = d.ResolveStorePath("cert.pem")
+
+	cert, err := GenerateClientCertificate(key, d.login(), keyFile, csrFile, certFile)
+	if err != nil {
+		return err
+	}
+
+	d.ClientCertExpiry = cert.NotAfter
+	return nil
+}
+
+// generateServerCertificate writes the server.pem and server-key.pem
+// docker-machine expects for the sdc-docker endpoint.
+func (d *Driver) generateServerCertificate() error {
+	log.Debugf("Generating server certificates")
+
+	host, err := d.GetIP()
+	if err != nil {
+		return err
+	}
+
+	var serverKeyFile = d.ResolveStorePath("server-key.pem")
+	var serverCertFile = d.ResolveStorePath("server.pem")
+
+	_, err = GenerateServerCertificate(host, serverKeyFile, serverCertFile)
+	return err
+}
+
+// clientCertExpiry returns when the client certificate expires, reading
+// cert.pem for machines created before the expiry was recorded.
+func (d *Driver) clientCertExpiry() (time.Time, error) {
+	if !d.ClientCertExpiry.IsZero() {
+		return d.ClientCertExpiry, nil
+	}
+
+	data, err := ioutil.ReadFile(d.ResolveStorePath("cert.pem"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certs[0].NotAfter, nil
+}
+
+// certExpiryWarning returns the warning to give about the client
+// certificate at now, or "" when it isn't expiring within
+// --triton-cert-expiry-warning days.
+func (d *Driver) certExpiryWarning(now time.Time) string {
+	if d.IsInstance() {
+		// Instances use the docker-machine certificates.
+		return ""
+	}
+
+	expiry, err := d.clientCertExpiry()
+	if err != nil {
+		log.Debugf("Unable to read the client certificate of %s: %s", d.MachineName, err)
+		return ""
+	}
+
+	renew := fmt.Sprintf("renew it with 'docker-machine-driver-triton regenerate-certs %s'", d.MachineName)
+	if !now.Before(expiry) {
+		return fmt.Sprintf("The client certificate of %s expired on %s, %s", d.MachineName, expiry.Format("2006-01-02"), renew)
+	}
+	days := d.CertExpiryWarning
+	if days == 0 && d.ClientCertExpiry.IsZero() {
+		// Machines created before the setting existed.
+		days = DefaultCertExpiryWarning
+	}
+	if expiry.Sub(now) <= time.Duration(days)*24*time.Hour {
+		return fmt.Sprintf("The client certificate of %s expires on %s, %s", d.MachineName, expiry.Format("2006-01-02"), renew)
+	}
+	return ""
+}
+
+// warnCertExpiry warns, once, when the client certificate expires soon.
+func (d *Driver) warnCertExpiry() {
+	if d.warnedCertExpiry {
+		return
+	}
+	warning := d.certExpiryWarning(time.Now())
+	if warning != "" {
+		log.Warnf("%s", warning)
+		d.warnedCertExpiry = true
+	}
+}
+
+// RegenerateCertificates reissues the client certificate from the SSH key,
+// and the server certificate, keeping the downloaded CA, without
+// re-creating the machine. The endpoint certificate is verified and
+// recorded again.
+func (d *Driver) RegenerateCertificates() error {
+	if d.IsInstance() {
+		return fmt.Errorf("%s uses the docker-machine certificates, renew them with 'docker-machine regenerate-certs %s'",
+			d.MachineName, d.MachineName)
+	}
+
+	err := d.verifyDockerEndpoint()
+	if err != nil {
+		return err
+	}
+
+	err = d.generateClientCertificate()
+	if err != nil {
+		return err
+	}
+
+	// Also replaces the copy of the SSH key older versions wrote to
+	// server-key.pem.
+	err = d.generateServerCertificate()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Regenerated the client certificate of %s, valid until %s", d.MachineName, d.ClientCertExpiry.Format("2006-01-02"))
+	return nil
+}
+
+// RegenerateMachineCertificates reissues the client certificate of the
+// machine stored in machineDir and records its expiry in config.json.
+// 'docker-machine regenerate-certs' provisions the host over SSH, which
+// sdc-docker machines don't have, so the driver binary runs this instead.
+func RegenerateMachineCertificates(machineDir string) error {
+	configFile := filepath.Join(machineDir, "config.json")
+	data, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("No machine found in %s, pass the docker-machine storage path with -s when it isn't the default", machineDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep the host settings the driver doesn't know about as they are.
+	var host map[string]json.RawMessage
+	err = json.Unmarshal(data, &host)
+	if err != nil {
+		return fmt.Errorf("Invalid %s: %s", configFile, err)
+	}
+	var name string
+	json.Unmarshal(host["DriverName"], &name)
+	if name != driverName {
+		return fmt.Errorf("%s is not a %s machine", machineDir, driverName)
+	}
+
+	d := &Driver{}
+	err = json.Unmarshal(host["Driver"], d)
+	if err != nil {
+		return fmt.Errorf("Invalid %s: %s", configFile, err)
+	}
+
+	err = d.RegenerateCertificates()
+	if err != nil {
+		return err
+	}
+
+	host["Driver"], err = json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(host, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFile, data, 0600)
+}
@@ -0,0 +1,142 @@
+package triton
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertExpiryWarning(t *testing.T) {
+	expiry := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	d := &Driver{
+		BaseDriver:        &drivers.BaseDriver{MachineName: "test-machine"},
+		ClientCertExpiry:  expiry,
+		CertExpiryWarning: 30,
+	}
+
+	assert.Equal(t, "", d.certExpiryWarning(expiry.AddDate(0, 0, -31)))
+	assert.Contains(t, d.certExpiryWarning(expiry.AddDate(0, 0, -30)), "expires on 2017-03-01")
+	assert.Contains(t, d.certExpiryWarning(expiry), "expired on 2017-03-01")
+	assert.Contains(t, d.certExpiryWarning(expiry), "regenerate-certs test-machine")
+
+	d.CertExpiryWarning = 0
+	assert.Equal(t, "", d.certExpiryWarning(expiry.AddDate(0, 0, -1)))
+	assert.Contains(t, d.certExpiryWarning(expiry.AddDate(0, 0, 1)), "expired")
+
+	d.Mode = ModeInstance
+	assert.Equal(t, "", d.certExpiryWarning(expiry.AddDate(0, 0, 1)))
+}
+
+func TestRegenerateMachineCertificates(t *testing.T) {
+	server, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	assert.Nil(t, ioutil.WriteFile(d.ResolveStorePath("ca.pem"), certificatePem(server.Certificate()), 0644))
+
+	config := `{
+		"ConfigVersion": 3,
+		"Driver": {"MachineName": "test-machine", "StorePath": "` + d.StorePath + `", "DockerApiURL": "` + d.DockerApiURL + `",
+			"Account": "test", "PrivateKey": "../../fixup/id_rsa", "Mode": "sdc-docker"},
+		"DriverName": "triton",
+		"HostOptions": {"Driver": ""},
+		"Name": "test-machine"
+	}`
+	machineDir := filepath.Dir(d.ResolveStorePath("config.json"))
+	configFile := filepath.Join(machineDir, "config.json")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(config), 0600))
+
+	assert.Nil(t, RegenerateMachineCertificates(machineDir))
+
+	data, err := ioutil.ReadFile(configFile)
+	assert.Nil(t, err)
+	var host struct {
+		Driver      *Driver
+		HostOptions map[string]string
+		Name        string
+	}
+	assert.Nil(t, json.Unmarshal(data, &host))
+	assert.Equal(t, "test-machine", host.Name)
+	assert.Equal(t, map[string]string{"Driver": ""}, host.HostOptions)
+	assert.Equal(t, "test", host.Driver.Account)
+	assert.Equal(t, CertFingerprint(server.Certificate()), host.Driver.DockerCertFingerprint)
+
+	cert := readPemFile(t, filepath.Join(machineDir, "cert.pem"))
+	parsed, err := x509.ParseCertificate(cert.Bytes)
+	assert.Nil(t, err, "invalid cert.pem")
+	assert.True(t, parsed.NotAfter.Equal(host.Driver.ClientCertExpiry), "the expiry of cert.pem wasn't recorded")
+
+	expiry, err := (&Driver{BaseDriver: host.Driver.BaseDriver}).clientCertExpiry()
+	assert.Nil(t, err)
+	assert.True(t, expiry.Equal(host.Driver.ClientCertExpiry), "the expiry wasn't read from cert.pem")
+}
+
+func TestRegenerateMachineCertificatesDockerMachineConfig(t *testing.T) {
+	server, d, cleanup := newCaServer(t)
+	defer cleanup()
+
+	assert.Nil(t, ioutil.WriteFile(d.ResolveStorePath("ca.pem"), certificatePem(server.Certificate()), 0644))
+
+	// A config.json as written by docker-machine 0.16 for a machine created
+	// by an older version of the driver.
+	data, err := ioutil.ReadFile("../../fixup/docker-machine/config.json")
+	assert.Nil(t, err)
+	config := strings.Replace(string(data), "STORE_PATH", d.StorePath, -1)
+	config = strings.Replace(config, "DOCKER_API_URL", d.DockerApiURL, -1)
+	machineDir := filepath.Dir(d.ResolveStorePath("config.json"))
+	configFile := filepath.Join(machineDir, "config.json")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(config), 0600))
+
+	assert.Nil(t, RegenerateMachineCertificates(machineDir))
+
+	data, err = ioutil.ReadFile(configFile)
+	assert.Nil(t, err)
+	var before, after map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(config), &before))
+	assert.Nil(t, json.Unmarshal(data, &after))
+
+	// docker-machine's own settings are kept as they are.
+	for _, key := range []string{"ConfigVersion", "DriverName", "HostOptions", "Name"} {
+		assert.Equal(t, before[key], after[key], key)
+	}
+	beforeDriver := before["Driver"].(map[string]interface{})
+	afterDriver := after["Driver"].(map[string]interface{})
+	for key, value := range beforeDriver {
+		assert.Equal(t, value, afterDriver[key], "Driver."+key)
+	}
+
+	var host struct {
+		Driver *Driver
+	}
+	assert.Nil(t, json.Unmarshal(data, &host))
+	assert.Equal(t, CertFingerprint(server.Certificate()), host.Driver.DockerCertFingerprint)
+	assert.False(t, host.Driver.ClientCertExpiry.IsZero(), "The expiry of the new certificate wasn't recorded")
+}
+
+func TestRegenerateMachineCertificatesOtherDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "triton-renew")
+	assert.Nil(t, err, "can't create temp dir")
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"Driver":{},"DriverName":"virtualbox"}`), 0600))
+	err = RegenerateMachineCertificates(dir)
+	assert.NotNil(t, err, "Regenerated the certificates of another driver")
+	assert.Contains(t, err.Error(), "not a triton machine")
+}
+
+func TestRegenerateMachineCertificatesMissingMachine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "triton-renew")
+	assert.Nil(t, err, "can't create temp dir")
+	defer os.RemoveAll(dir)
+
+	err = RegenerateMachineCertificates(filepath.Join(dir, "machines", "test-machine"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "storage path")
+}
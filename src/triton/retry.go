@@ -0,0 +1,203 @@
+package triton
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// DefaultTimeout is the default of --triton-timeout, in seconds.
+	DefaultTimeout = 60
+	// DefaultRetries is the default of --triton-retries.
+	DefaultRetries = 4
+
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// timeout returns the --triton-timeout as a duration.
+func (d *Driver) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return DefaultTimeout * time.Second
+	}
+	return time.Duration(d.Timeout) * time.Second
+}
+
+// RetryTransport is an http.RoundTripper retrying requests that failed
+// transiently, with exponential backoff and jitter between attempts.
+//
+// Requests with idempotent methods are retried on network errors and 5xx
+// responses. Other requests (e.g. creating a machine) are only retried
+// when they can't have been processed: on 429 responses and when the
+// connection couldn't be established. A Retry-After header of the response
+// is honored up to MaxDelay.
+type RetryTransport struct {
+	Base http.RoundTripper
+	// Retries is the number of retries after the first attempt.
+	Retries   int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// sleep waits between attempts, replaced by tests.
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retries := t.Retries
+	if req.Body != nil && req.GetBody == nil {
+		// The body can't be sent again.
+		retries = 0
+	}
+
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(attemptReq)
+		if attempt >= retries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+				if delay > t.maxDelay() {
+					delay = t.maxDelay()
+				}
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			log.Debugf("%s %s returned %d, retrying in %s", req.Method, req.URL, resp.StatusCode, delay)
+		} else {
+			log.Debugf("%s %s failed: %s, retrying in %s", req.Method, req.URL, err, delay)
+		}
+
+		sleep := t.sleep
+		if sleep == nil {
+			sleep = sleepContext
+		}
+		err = sleep(req.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+
+		attemptReq = req.Clone(req.Context())
+		if req.Body != nil {
+			attemptReq.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (t *RetryTransport) maxDelay() time.Duration {
+	if t.MaxDelay > 0 {
+		return t.MaxDelay
+	}
+	return retryMaxDelay
+}
+
+// backoff returns the delay before the retry following the given attempt:
+// exponentially growing from BaseDelay, capped at MaxDelay, of which up to
+// half is random so clients don't retry in lockstep.
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.BaseDelay
+	if delay <= 0 {
+		delay = retryBaseDelay
+	}
+	for i := 0; i < attempt && delay < t.maxDelay(); i++ {
+		delay *= 2
+	}
+	if delay > t.maxDelay() {
+		delay = t.maxDelay()
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isIdempotent reports whether sending req more than once has the same
+// effect as sending it once.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// shouldRetry reports whether the outcome of an attempt is transient and
+// req may be sent again.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		// Other errors, e.g. failing to sign the request or to verify the
+		// server certificate, won't go away by trying again.
+		var netErr net.Error
+		if !errors.As(err, &netErr) && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false
+		}
+		if isIdempotent(req) {
+			return true
+		}
+		// Failing to connect means the request was never sent.
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+		return isIdempotent(req)
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or
+// as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(time.Now())
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for delay or until ctx is done.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,177 @@
+package triton
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newRetryTransport returns a RetryTransport recording its delays instead
+// of sleeping.
+func newRetryTransport(base http.RoundTripper, delays *[]time.Duration) *RetryTransport {
+	return &RetryTransport{
+		Base:    base,
+		Retries: 3,
+		sleep: func(ctx context.Context, delay time.Duration) error {
+			*delays = append(*delays, delay)
+			return nil
+		},
+	}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	client := &http.Client{Transport: newRetryTransport(nil, &delays)}
+
+	req, err := http.NewRequest("PUT", server.URL, strings.NewReader(`{"name":"test"}`))
+	assert.Nil(t, err)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{`{"name":"test"}`, `{"name":"test"}`, `{"name":"test"}`}, bodies, "The body wasn't sent again")
+	assert.Len(t, delays, 2)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	attempts := 0
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	var delays []time.Duration
+	req, _ := http.NewRequest("GET", "https://cloudapi.test/test/services", nil)
+	resp, err := newRetryTransport(base, &delays).RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, 4, attempts)
+	for i, delay := range delays {
+		max := retryBaseDelay << uint(i)
+		assert.True(t, delay >= max/2 && delay <= max, "Delay out of range")
+	}
+}
+
+func TestRetryPolicyForMutatingRequests(t *testing.T) {
+	for _, tc := range []struct {
+		status   int
+		err      error
+		attempts int
+	}{
+		{status: http.StatusServiceUnavailable, attempts: 1},
+		{status: http.StatusInternalServerError, attempts: 1},
+		{status: http.StatusTooManyRequests, attempts: 4},
+		{err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, attempts: 1},
+		{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, attempts: 4},
+	} {
+		attempts := 0
+		base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if tc.err != nil {
+				return nil, tc.err
+			}
+			return &http.Response{StatusCode: tc.status, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})
+
+		var delays []time.Duration
+		req, _ := http.NewRequest("POST", "https://cloudapi.test/test/machines", nil)
+		newRetryTransport(base, &delays).RoundTrip(req)
+		assert.Equal(t, tc.attempts, attempts, tc.status, tc.err)
+	}
+}
+
+func TestRetryOnlyNetworkErrors(t *testing.T) {
+	attempts := 0
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, errors.New("Unable to read the key passphrase file")
+	})
+
+	var delays []time.Duration
+	req, _ := http.NewRequest("GET", "https://cloudapi.test/test/services", nil)
+	_, err := newRetryTransport(base, &delays).RoundTrip(req)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryAfter(t *testing.T) {
+	attempts := 0
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		header := http.Header{}
+		switch attempts {
+		case 1:
+			header.Set("Retry-After", "2")
+		case 2:
+			header.Set("Retry-After", "3600")
+		default:
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: header, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	var delays []time.Duration
+	req, _ := http.NewRequest("POST", "https://cloudapi.test/test/machines", nil)
+	resp, err := newRetryTransport(base, &delays).RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []time.Duration{2 * time.Second, retryMaxDelay}, delays)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	delay, ok := parseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 120*time.Second, delay)
+
+	delay, ok = parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.True(t, delay > 58*time.Second && delay <= time.Minute, "Wrong delay for an HTTP date")
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+func TestHttpClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer server.Close()
+
+	d := &Driver{Timeout: 1}
+	client := d.httpClient(d.httpTransport(nil))
+	client.Transport.(*RetryTransport).sleep = func(ctx context.Context, delay time.Duration) error {
+		return nil
+	}
+
+	start := time.Now()
+	_, err := client.Get(server.URL)
+	assert.NotNil(t, err, "A stalled server didn't time out")
+	assert.True(t, time.Since(start) < 2*time.Second, "Waited past the timeout")
+}
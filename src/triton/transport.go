@@ -0,0 +1,124 @@
+package triton
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+)
+
+// Version and GitCommit identify the driver in the User-Agent of its
+// requests, main sets them to those of the build.
+var (
+	Version   = "dev"
+	GitCommit = "HEAD"
+)
+
+// userAgent returns the User-Agent of the requests of the driver.
+func userAgent() string {
+	return fmt.Sprintf("docker-machine-driver-triton/%s (%s; %s; %s/%s)",
+		Version, GitCommit, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// parseProxy parses the --triton-proxy URL.
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("%q is not an http, https or socks5 URL", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q has no host", proxy)
+	}
+	return u, nil
+}
+
+// proxy returns the proxy requests are sent through: --triton-proxy, or
+// else the one of the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment
+// variables.
+func (d *Driver) proxy(req *http.Request) (*url.URL, error) {
+	if d.Proxy == "" {
+		return http.ProxyFromEnvironment(req)
+	}
+	return parseProxy(d.Proxy)
+}
+
+// httpTransport returns a transport for requests to CloudAPI and
+// sdc-docker. Connecting, the TLS handshake and waiting for the response
+// headers are each bounded by the timeout.
+func (d *Driver) httpTransport(tlsConfig *tls.Config) *http.Transport {
+	timeout := d.timeout()
+	return &http.Transport{
+		Proxy:           d.proxy,
+		TLSClientConfig: tlsConfig,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   4,
+	}
+}
+
+// sharedTransport returns the transport for endpoints verified against
+// the CAs of caFile, the system ones when empty. It is created once per
+// driver so that connections are kept alive between requests.
+func (d *Driver) sharedTransport(caFile string) (*http.Transport, error) {
+	key := fmt.Sprintf("%t %s", d.SkipTlsVerify, caFile)
+	if transport, ok := d.transports[key]; ok {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.SkipTlsVerify}
+	if !d.SkipTlsVerify && caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if d.transports == nil {
+		d.transports = make(map[string]*http.Transport)
+	}
+	d.transports[key] = d.httpTransport(tlsConfig)
+	return d.transports[key], nil
+}
+
+// httpClient returns a client sending requests through base, retrying
+// transient failures. Its timeout bounds a whole call, retries included,
+// so a stalled response body can't hang docker-machine.
+func (d *Driver) httpClient(base http.RoundTripper) *http.Client {
+	retries := d.Retries
+	if retries < 0 {
+		retries = 0
+	}
+	return &http.Client{
+		Transport: &RetryTransport{
+			Base:    &userAgentTransport{base: base},
+			Retries: retries,
+		},
+		Timeout: time.Duration(retries+1)*d.timeout() + time.Duration(retries)*retryMaxDelay,
+	}
+}
+
+// userAgentTransport sets the User-Agent of the driver on requests, before
+// they are signed.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent())
+	return t.base.RoundTrip(req)
+}